@@ -6,42 +6,252 @@ import (
 	"crypto/subtle"
 	"encoding/hex"
 	"io"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/arjantop/pwned-passwords/pwnedpasswords"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ntlmHashSize is the size of an NTLM (MD4) hash in bytes.
+const ntlmHashSize = 16
+
+const (
+	// defaultPrefixLength is the prefix length assumed until the server reports a different one.
+	defaultPrefixLength = 5
+	// prefixLengthKey is the trailer in which the server reports the prefix length of its dataset.
+	prefixLengthKey = "prefix-length"
+	// maxPrefixLength is the longest prefix length supported by the server. It is shorter
+	// than the hex encoding of every supported hash.
+	maxPrefixLength = 8
 )
 
 type Client struct {
 	C pwnedpasswords.PwnedPasswordsClient
+	// AddPadding requests responses padded with decoy hashes so their size does not
+	// reveal the checked prefix to network observers. Decoys are discarded by the client.
+	AddPadding bool
+
+	// prefixLength is the length of hash prefixes expected by the server, accessed atomically.
+	// It is discovered from the server if the dataset uses a non-default length.
+	prefixLength int32
+}
+
+// PrefixLength returns the number of hex characters of the hash sent to the server.
+func (c *Client) PrefixLength() int {
+	if n := atomic.LoadInt32(&c.prefixLength); n > 0 {
+		return int(n)
+	}
+	return defaultPrefixLength
+}
+
+// withPrefixLength calls f with the current prefix length. If the server rejects the prefix
+// because its dataset uses a different length, the length is updated and f is retried once.
+// f returns the trailer of the call, which carries the expected length.
+func (c *Client) withPrefixLength(f func(prefixLength int) (metadata.MD, error)) error {
+	length := c.PrefixLength()
+	trailer, err := f(length)
+	if expected, ok := expectedPrefixLength(trailer, err); ok && expected != length {
+		atomic.StoreInt32(&c.prefixLength, int32(expected))
+		_, err = f(expected)
+	}
+	return err
+}
+
+// expectedPrefixLength returns the prefix length reported by the server if the call failed
+// because of a prefix of the wrong length.
+func expectedPrefixLength(trailer metadata.MD, err error) (int, bool) {
+	if status.Code(errors.Cause(err)) != codes.InvalidArgument {
+		return 0, false
+	}
+	values := trailer.Get(prefixLengthKey)
+	if len(values) != 1 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(values[0])
+	if err != nil || n < 1 || n > maxPrefixLength {
+		return 0, false
+	}
+	return n, true
 }
 
 func (c *Client) IsPasswordPwned(ctx context.Context, password string) (bool, error) {
+	count, err := c.PasswordPwnedCount(ctx, password)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// PasswordPwnedCount returns the number of times the password has been seen in breaches.
+// Zero is returned for passwords that have not been pwned.
+func (c *Client) PasswordPwnedCount(ctx context.Context, password string) (uint32, error) {
 	hash := sha1.Sum([]byte(password))
-	// Take first five hex characters from the computed hash
-	prefix := hex.EncodeToString(hash[:3])[:5]
+	return c.hashPwnedCount(ctx, pwnedpasswords.HashType_SHA1, hash[:])
+}
 
-	r, err := c.C.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{
-		HashPrefix: prefix,
+// IsNTLMHashPwned checks if the password with the given NTLM hash has been pwned.
+func (c *Client) IsNTLMHashPwned(ctx context.Context, hash []byte) (bool, error) {
+	if len(hash) != ntlmHashSize {
+		return false, errors.Errorf("NTLM hash must be %d bytes long", ntlmHashSize)
+	}
+
+	count, err := c.hashPwnedCount(ctx, pwnedpasswords.HashType_NTLM, hash)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CheckMany returns the number of times each of the passwords has been seen in breaches.
+// Counts are returned in the same order as passwords.
+//
+// All prefixes are checked over a single stream and every distinct prefix is requested only once.
+func (c *Client) CheckMany(ctx context.Context, passwords []string) ([]uint32, error) {
+	if len(passwords) == 0 {
+		return nil, nil
+	}
+
+	hashes := make([][sha1.Size]byte, len(passwords))
+	for i, password := range passwords {
+		hashes[i] = sha1.Sum([]byte(password))
+	}
+
+	var counts []uint32
+	err := c.withPrefixLength(func(prefixLength int) (metadata.MD, error) {
+		var trailer metadata.MD
+		var err error
+		counts, trailer, err = c.checkMany(ctx, hashes, prefixLength)
+		return trailer, err
+	})
+	return counts, err
+}
+
+func (c *Client) checkMany(ctx context.Context, hashes [][sha1.Size]byte, prefixLength int) ([]uint32, metadata.MD, error) {
+	// Indexes of hashes grouped by the request id of their prefix.
+	var prefixes []string
+	groups := make(map[uint64][]int)
+	requestIds := make(map[string]uint64)
+	for i := range hashes {
+		prefix := hashPrefix(hashes[i][:], prefixLength)
+
+		id, ok := requestIds[prefix]
+		if !ok {
+			id = uint64(len(prefixes))
+			requestIds[prefix] = id
+			prefixes = append(prefixes, prefix)
+		}
+		groups[id] = append(groups[id], i)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.C.CheckPrefixes(ctx)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "call failed")
+	}
+
+	sendErr := make(chan error, 1)
+	go func() {
+		for id, prefix := range prefixes {
+			err := stream.Send(&pwnedpasswords.CheckPrefixesRequest{
+				RequestId:  uint64(id),
+				HashPrefix: prefix,
+				HashType:   pwnedpasswords.HashType_SHA1,
+				AddPadding: c.AddPadding,
+			})
+			if err != nil {
+				// The actual error is returned by Recv.
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- stream.CloseSend()
+	}()
+
+	counts := make([]uint32, len(hashes))
+	received := 0
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, stream.Trailer(), errors.WithMessage(err, "receive failed")
+		}
+
+		group, ok := groups[resp.RequestId]
+		if !ok {
+			return nil, nil, errors.Errorf("received response for unknown request %d", resp.RequestId)
+		}
+		received++
+
+		// Compare all hashes for the same reason as in hashPwnedCount.
+		for _, i := range group {
+			for _, h := range resp.Hashes {
+				if subtle.ConstantTimeCompare(hashes[i][:], h.Hash) == 1 && !h.Padding {
+					counts[i] = h.Count
+				}
+			}
+		}
+	}
+
+	if err := <-sendErr; err != nil && err != io.EOF {
+		return nil, nil, errors.WithMessage(err, "send failed")
+	}
+	if received != len(prefixes) {
+		return nil, nil, errors.Errorf("received %d responses for %d prefixes", received, len(prefixes))
+	}
+
+	return counts, nil, nil
+}
+
+// hashPrefix returns the first prefixLength hex characters of the hash.
+func hashPrefix(hash []byte, prefixLength int) string {
+	return hex.EncodeToString(hash[:(prefixLength+1)/2])[:prefixLength]
+}
+
+func (c *Client) hashPwnedCount(ctx context.Context, hashType pwnedpasswords.HashType, hash []byte) (uint32, error) {
+	var count uint32
+	err := c.withPrefixLength(func(prefixLength int) (metadata.MD, error) {
+		var trailer metadata.MD
+		var err error
+		count, err = c.listHashes(ctx, hashType, hash, prefixLength, &trailer)
+		return trailer, err
 	})
+	return count, err
+}
+
+func (c *Client) listHashes(ctx context.Context, hashType pwnedpasswords.HashType, hash []byte, prefixLength int, trailer *metadata.MD) (uint32, error) {
+	r, err := c.C.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{
+		HashPrefix: hashPrefix(hash, prefixLength),
+		HashType:   hashType,
+		AddPadding: c.AddPadding,
+	}, grpc.Trailer(trailer))
 	if err != nil {
-		return false, errors.WithMessage(err, "call failed")
+		return 0, errors.WithMessage(err, "call failed")
 	}
 
 	// Always receive and compare all hashes so we do not leak any timing information to the server
 	// by closing the connection early.
-	var matchFound bool
+	var count uint32
 	for {
 		h, err := r.Recv()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return false, errors.WithMessage(err, "receive failed")
+			return 0, errors.WithMessage(err, "receive failed")
 		}
-		if subtle.ConstantTimeCompare(hash[:], h.Hash) == 1 {
-			matchFound = true
+		if subtle.ConstantTimeCompare(hash, h.Hash) == 1 && !h.Padding {
+			count = h.Count
 		}
 	}
 
-	return matchFound, nil
+	return count, nil
 }
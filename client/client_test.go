@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"crypto/sha1"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjantop/pwned-passwords/internal/grpctest"
+	"github.com/arjantop/pwned-passwords/pwnedpasswords"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeServer serves hashes of the passwords it was created with.
+type fakeServer struct {
+	pwnedpasswords.UnimplementedPwnedPasswordsServer
+
+	prefixLength int
+	hashes       map[string][]*pwnedpasswords.PasswordHash
+
+	mu              sync.Mutex
+	checkedPrefixes []string
+}
+
+func newFakeServer(counts map[string]uint32) *fakeServer {
+	return newFakeServerWithPrefixLength(counts, defaultPrefixLength)
+}
+
+func newFakeServerWithPrefixLength(counts map[string]uint32, prefixLength int) *fakeServer {
+	s := &fakeServer{prefixLength: prefixLength, hashes: make(map[string][]*pwnedpasswords.PasswordHash)}
+	for password, count := range counts {
+		hash := sha1.Sum([]byte(password))
+		prefix := hashPrefix(hash[:], prefixLength)
+		s.hashes[prefix] = append(s.hashes[prefix], &pwnedpasswords.PasswordHash{Hash: hash[:], Count: count})
+	}
+	return s
+}
+
+// checkPrefixLength rejects prefixes of the wrong length like the real server.
+func (s *fakeServer) checkPrefixLength(ctx context.Context, prefix string) error {
+	if len(prefix) == s.prefixLength {
+		return nil
+	}
+	grpc.SetTrailer(ctx, metadata.Pairs(prefixLengthKey, strconv.Itoa(s.prefixLength)))
+	return status.Error(codes.InvalidArgument, "invalid prefix length")
+}
+
+func (s *fakeServer) ListHashesForPrefix(req *pwnedpasswords.ListRequest, resp pwnedpasswords.PwnedPasswords_ListHashesForPrefixServer) error {
+	if err := s.checkPrefixLength(resp.Context(), req.HashPrefix); err != nil {
+		return err
+	}
+	for _, h := range s.hashes[req.HashPrefix] {
+		if err := resp.Send(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeServer) CheckPrefixes(stream pwnedpasswords.PwnedPasswords_CheckPrefixesServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.checkPrefixLength(stream.Context(), req.HashPrefix); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.checkedPrefixes = append(s.checkedPrefixes, req.HashPrefix)
+		s.mu.Unlock()
+
+		err = stream.Send(&pwnedpasswords.CheckPrefixesResponse{
+			RequestId: req.RequestId,
+			Hashes:    s.hashes[req.HashPrefix],
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func createClient(s pwnedpasswords.PwnedPasswordsServer) (*Client, *grpctest.Server) {
+	testServer := grpctest.NewServer(func(srv *grpc.Server) {
+		pwnedpasswords.RegisterPwnedPasswordsServer(srv, s)
+	})
+
+	return &Client{C: pwnedpasswords.NewPwnedPasswordsClient(testServer.ClientConn())}, testServer
+}
+
+func TestClientPasswordPwnedCount(t *testing.T) {
+	c, s := createClient(newFakeServer(map[string]uint32{"password": 42}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := c.PasswordPwnedCount(ctx, "password")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(42), count)
+
+	pwned, err := c.IsPasswordPwned(ctx, "not pwned")
+	assert.NoError(t, err)
+	assert.False(t, pwned)
+}
+
+func TestClientCheckManyDeduplicatesPrefixes(t *testing.T) {
+	server := newFakeServer(map[string]uint32{"password": 42, "123456": 7})
+	c, s := createClient(server)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	counts, err := c.CheckMany(ctx, []string{"password", "not pwned", "123456", "password"})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{42, 0, 7, 42}, counts)
+	assert.Len(t, server.checkedPrefixes, 3)
+}
+
+func TestClientIgnoresPaddingHashes(t *testing.T) {
+	server := newFakeServer(map[string]uint32{"password": 42})
+	decoy := sha1.Sum([]byte("decoy"))
+	prefix := hashPrefix(decoy[:], defaultPrefixLength)
+	server.hashes[prefix] = append(server.hashes[prefix], &pwnedpasswords.PasswordHash{Hash: decoy[:], Count: 7, Padding: true})
+
+	c, s := createClient(server)
+	defer s.Close()
+	c.AddPadding = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := c.PasswordPwnedCount(ctx, "decoy")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), count)
+
+	counts, err := c.CheckMany(ctx, []string{"password", "decoy"})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{42, 0}, counts)
+}
+
+func TestClientDiscoversPrefixLength(t *testing.T) {
+	for _, prefixLength := range []int{4, 6} {
+		server := newFakeServerWithPrefixLength(map[string]uint32{"password": 42, "123456": 7}, prefixLength)
+		c, s := createClient(server)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		count, err := c.PasswordPwnedCount(ctx, "password")
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(42), count)
+		assert.Equal(t, prefixLength, c.PrefixLength())
+
+		// A new client discovers the length on its first streaming call.
+		c.prefixLength = 0
+		counts, err := c.CheckMany(ctx, []string{"password", "123456"})
+		assert.NoError(t, err)
+		assert.Equal(t, []uint32{42, 7}, counts)
+		assert.Equal(t, prefixLength, c.PrefixLength())
+
+		cancel()
+		s.Close()
+	}
+}
+
+func TestClientRejectsUnsupportedPrefixLength(t *testing.T) {
+	server := newFakeServerWithPrefixLength(nil, 2*sha1.Size)
+	c, s := createClient(server)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := c.IsNTLMHashPwned(ctx, make([]byte, ntlmHashSize))
+	assert.Equal(t, codes.InvalidArgument, status.Code(errors.Cause(err)))
+	_, err = c.PasswordPwnedCount(ctx, "password")
+	assert.Error(t, err)
+	assert.Equal(t, defaultPrefixLength, c.PrefixLength())
+}
+
+func TestHashPrefix(t *testing.T) {
+	hash := []byte{0xab, 0xcd, 0xef, 0x12}
+	assert.Equal(t, "abcd", hashPrefix(hash, 4))
+	assert.Equal(t, "abcde", hashPrefix(hash, 5))
+	assert.Equal(t, "abcdef", hashPrefix(hash, 6))
+}
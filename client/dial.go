@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// DialOptions configures connections created by Dial.
+type DialOptions struct {
+	// Insecure disables TLS. It should only be used with servers on trusted networks.
+	Insecure bool
+	// CAFile is an optional path of PEM encoded certificates of CAs trusted to sign the
+	// server certificate. System roots are used if it is not set.
+	CAFile string
+	// CertFile and KeyFile are optional paths of the PEM encoded certificate and key
+	// presented to servers that require mutual TLS. They are read on every handshake
+	// so rotated certificates are used for new connections.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name the server certificate is verified against.
+	ServerName string
+	// APIKey is an optional key sent with every request to servers that require
+	// authentication.
+	APIKey string
+}
+
+// Dial connects to the server at target. Additional options are passed to grpc.Dial.
+func Dial(target string, options DialOptions, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if options.APIKey != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(apiKeyCredentials{key: options.APIKey, insecure: options.Insecure}))
+	}
+	if options.Insecure {
+		return grpc.Dial(target, append(opts, grpc.WithInsecure())...)
+	}
+
+	config, err := options.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Dial(target, append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))...)
+}
+
+func (o DialOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: o.ServerName,
+	}
+
+	if o.CAFile != "" {
+		buf, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, errors.WithMessage(err, "reading CAs failed")
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(buf) {
+			return nil, errors.Errorf("no certificates found in '%s'", o.CAFile)
+		}
+	}
+
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return nil, errors.New("both certificate and key are required for mutual TLS")
+	}
+	if o.CertFile != "" {
+		// Fail early if the certificate can not be loaded.
+		if _, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile); err != nil {
+			return nil, errors.WithMessage(err, "loading client certificate failed")
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+			if err != nil {
+				return nil, errors.WithMessage(err, "loading client certificate failed")
+			}
+			return &cert, nil
+		}
+	}
+
+	return config, nil
+}
+
+// apiKeyCredentials sends the API key in the authorization metadata of every request.
+type apiKeyCredentials struct {
+	key string
+	// insecure allows sending the key without TLS. It is only set if TLS was disabled explicitly.
+	insecure bool
+}
+
+func (c apiKeyCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.key}, nil
+}
+
+func (c apiKeyCredentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/arjantop/pwned-passwords/internal/grpctest"
+	"github.com/arjantop/pwned-passwords/pwnedpasswords"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// serveMutualTLS serves the fake server requiring client certificates signed by the CA.
+func serveMutualTLS(t *testing.T, certs grpctest.Certificates) (string, func()) {
+	cert, err := tls.LoadX509KeyPair(certs.ServerCertFile, certs.ServerKeyFile)
+	require.NoError(t, err)
+	buf, err := ioutil.ReadFile(certs.CAFile)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(buf))
+
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})))
+	pwnedpasswords.RegisterPwnedPasswordsServer(srv, newFakeServer(map[string]uint32{"password": 42}))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(lis)
+
+	return lis.Addr().String(), srv.Stop
+}
+
+func passwordPwnedCount(t *testing.T, addr string, options DialOptions) (uint32, error) {
+	conn, err := Dial(addr, options)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := &Client{C: pwnedpasswords.NewPwnedPasswordsClient(conn)}
+	return c.PasswordPwnedCount(ctx, "password")
+}
+
+func TestDialWithMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dial")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certs := grpctest.WriteCertificates(dir)
+	addr, stop := serveMutualTLS(t, certs)
+	defer stop()
+
+	count, err := passwordPwnedCount(t, addr, DialOptions{
+		CAFile:     certs.CAFile,
+		CertFile:   certs.ClientCertFile,
+		KeyFile:    certs.ClientKeyFile,
+		ServerName: "localhost",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(42), count)
+
+	_, err = passwordPwnedCount(t, addr, DialOptions{CAFile: certs.CAFile, ServerName: "localhost"})
+	assert.Error(t, err, "client certificate is required")
+	_, err = passwordPwnedCount(t, addr, DialOptions{CertFile: certs.ClientCertFile, KeyFile: certs.ClientKeyFile, ServerName: "localhost"})
+	assert.Error(t, err, "server certificate is not signed by a system root")
+	_, err = passwordPwnedCount(t, addr, DialOptions{Insecure: true})
+	assert.Error(t, err)
+}
+
+func TestDialFailsWithInvalidOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dial")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certs := grpctest.WriteCertificates(dir)
+	for _, options := range []DialOptions{
+		{CAFile: "missing.pem"},
+		{CAFile: certs.ServerKeyFile},
+		{CertFile: certs.ClientCertFile},
+		{CertFile: certs.ClientCertFile, KeyFile: certs.ServerKeyFile},
+	} {
+		_, err := Dial("localhost:0", options)
+		assert.Error(t, err, "%+v", options)
+	}
+}
+
+func TestAPIKeyCredentials(t *testing.T) {
+	c := apiKeyCredentials{key: "key1"}
+	md, err := c.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer key1"}, md)
+	assert.True(t, c.RequireTransportSecurity(), "keys are only sent over TLS by default")
+
+	assert.False(t, apiKeyCredentials{key: "key1", insecure: true}.RequireTransportSecurity())
+}
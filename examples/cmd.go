@@ -19,6 +19,12 @@ import (
 
 var (
 	serverAddr     = flag.String("addr", "", "address and port of remote server")
+	useTLS         = flag.Bool("tls", false, "Connect to the server using TLS")
+	caFile         = flag.String("caFile", "", "PEM encoded CA certificates trusted to sign the server certificate (system roots if empty)")
+	certFile       = flag.String("certFile", "", "PEM encoded client certificate for servers requiring mutual TLS")
+	keyFile        = flag.String("keyFile", "", "PEM encoded private key of the client certificate")
+	serverName     = flag.String("serverName", "", "Name the server certificate is verified against (host of addr if empty)")
+	apiKey         = flag.String("apiKey", "", "API key for servers that require authentication")
 	promGateway    = flag.String("promGateway", "", "URL of Prometheus push gateway")
 	jaegerEndpoint = flag.String("jaegerEndpoint", "", "Endpoint of jaeger tracing")
 )
@@ -78,7 +84,14 @@ func main() {
 	// For demo purposes
 	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
 
-	conn, err := grpc.Dial(*serverAddr, grpc.WithStatsHandler(&ocgrpc.ClientHandler{}), grpc.WithInsecure())
+	conn, err := client.Dial(*serverAddr, client.DialOptions{
+		Insecure:   !*useTLS,
+		CAFile:     *caFile,
+		CertFile:   *certFile,
+		KeyFile:    *keyFile,
+		ServerName: *serverName,
+		APIKey:     *apiKey,
+	}, grpc.WithStatsHandler(&ocgrpc.ClientHandler{}))
 	if err != nil {
 		log.Fatalf("Could not dial: %s", err)
 	}
@@ -91,19 +104,18 @@ func main() {
 	ctx, span := trace.StartSpan(context.Background(), "Cmd")
 	defer span.End()
 
-	for _, password := range passwords {
-		pwned, err := c.IsPasswordPwned(ctx, password)
-		if err != nil {
-			log.Printf("Pwned password call failed: %s", err)
-			tracing.RecordError(span, err)
-			return
-		}
+	counts, err := c.CheckMany(ctx, passwords)
+	if err != nil {
+		log.Printf("Pwned password call failed: %s", err)
+		tracing.RecordError(span, err)
+		return
+	}
 
-		if pwned {
-			log.Println("The password has been pwned")
+	for _, count := range counts {
+		if count > 0 {
+			log.Printf("The password has been pwned %d times", count)
 		} else {
 			log.Println("The password has not been pwned yet")
 		}
 	}
-
 }
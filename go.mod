@@ -17,10 +17,10 @@ require (
 	github.com/stretchr/testify v1.3.0
 	go.opencensus.io v0.20.2
 	golang.org/x/net v0.0.0-20190415214537-1da14a5a36f2
-	golang.org/x/sync v0.0.0-20190412183630-56d357773e84 // indirect
+	golang.org/x/sync v0.0.0-20190412183630-56d357773e84
 	golang.org/x/sys v0.0.0-20190416152802-12500544f89f // indirect
 	golang.org/x/text v0.3.1-0.20180807135948-17ff2d5776d2 // indirect
 	google.golang.org/api v0.3.2 // indirect
-	google.golang.org/genproto v0.0.0-20190415143225-d1146b9035b9 // indirect
+	google.golang.org/genproto v0.0.0-20190415143225-d1146b9035b9
 	google.golang.org/grpc v1.20.0
 )
@@ -0,0 +1,233 @@
+package grpcbase
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationKey is the metadata key of the API key, sent as "Bearer <key>" like the
+// HTTP Authorization header.
+const authorizationKey = "authorization"
+
+// tenantKey is the metadata key of the tenant of requests forwarded by the gateway.
+const tenantKey = "x-grpcbase-tenant"
+
+const bearerPrefix = "Bearer "
+
+// Failed authentications are limited to authFailureBurst at once and authFailureRate
+// per second on average for every client address so keys can not be guessed.
+const (
+	authFailureRate  = 0.1
+	authFailureBurst = 10
+)
+
+// healthServicePrefix is the prefix of methods of the health service. They are called
+// by orchestrators that have no API key.
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+// keyStore maps API keys to tenants. Keys are stored hashed so lookups take the same
+// time for all keys.
+type keyStore struct {
+	path string
+
+	mu      sync.RWMutex
+	tenants map[[sha256.Size]byte]string
+}
+
+func loadKeyStore(path string) (*keyStore, error) {
+	ks := &keyStore{path: path}
+	if err := ks.reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// reload reads the key file. Keys are kept if the file can not be read.
+func (ks *keyStore) reload() error {
+	tenants, err := readKeyFile(ks.path)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	ks.tenants = tenants
+	ks.mu.Unlock()
+	return nil
+}
+
+// tenant returns the tenant the key belongs to.
+func (ks *keyStore) tenant(key string) (string, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	tenant, ok := ks.tenants[sha256.Sum256([]byte(key))]
+	return tenant, ok
+}
+
+// readKeyFile reads a file with a tenant and its API key separated by whitespace on
+// every line. Empty lines and lines starting with # are ignored. A tenant can have
+// multiple keys so they can be rotated.
+func readKeyFile(path string) (map[[sha256.Size]byte]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "opening API key file failed")
+	}
+	defer f.Close()
+
+	tenants := make(map[[sha256.Size]byte]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("invalid API key file: line %d must contain a tenant and a key", line)
+		}
+		hash := sha256.Sum256([]byte(fields[1]))
+		if _, ok := tenants[hash]; ok {
+			return nil, errors.Errorf("invalid API key file: line %d contains a duplicate key", line)
+		}
+		tenants[hash] = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessage(err, "reading API key file failed")
+	}
+	if len(tenants) == 0 {
+		return nil, errors.New("invalid API key file: no keys found")
+	}
+	return tenants, nil
+}
+
+type tenantContextKey struct{}
+
+// withTenant returns a context with the tenant set as the client identity and records
+// the tenant on the trace span.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	trace.FromContext(ctx).AddAttributes(trace.StringAttribute("tenant", tenant))
+	ctx = context.WithValue(ctx, tenantContextKey{}, tenant)
+	return WithIdentity(ctx, "tenant:"+tenant)
+}
+
+// Tenant returns the tenant of an authenticated request.
+func Tenant(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok
+}
+
+// SetAPIKeys requires clients to authenticate with an API key from the key file. The
+// key is read from the authorization metadata of gRPC requests and the Authorization
+// header of HTTP requests, both in the form "Bearer <key>". The tenant of the key is
+// available with Tenant and is the client identity seen by interceptors and middleware
+// added later, for example the rate limiter. The key file is reloaded on SIGHUP.
+//
+// Clients that repeatedly fail to authenticate are rejected like rate limited requests
+// until their failures are below the limit again. Health checks do not require a key.
+func (s *Server) SetAPIKeys(keyFile string) error {
+	ks, err := loadKeyStore(keyFile)
+	if err != nil {
+		return err
+	}
+	s.OnReload(ks.reload)
+	failures := newLimiter(RateLimit{Rate: authFailureRate, Burst: authFailureBurst})
+
+	s.AddInterceptors(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+				return handler(ctx, req)
+			}
+			ctx, err := s.authenticate(ctx, ks, failures)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		},
+		func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+				return handler(srv, stream)
+			}
+			ctx, err := s.authenticate(stream.Context(), ks, failures)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+		},
+	)
+
+	s.AddHTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := HTTPClientIdentity(r)
+			if limited, retryAfter := failures.exhausted(client); limited {
+				writeRateLimited(w, r, retryAfter)
+				return
+			}
+
+			tenant, ok := ks.tenant(bearerToken(r.Header.Get("Authorization")))
+			if !ok {
+				failures.allow(client)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withTenant(r.Context(), tenant)))
+		})
+	})
+
+	return nil
+}
+
+// authenticate returns a context with the tenant of the API key in the request metadata.
+// Requests forwarded by the gateway were authenticated by the gateway and carry the tenant.
+// Failures are counted for the client address.
+func (s *Server) authenticate(ctx context.Context, ks *keyStore, failures *limiter) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if s.isSelf(ctx) {
+		if tenants := md.Get(tenantKey); len(tenants) > 0 {
+			return withTenant(ctx, tenants[0]), nil
+		}
+		return ctx, nil
+	}
+
+	client := ClientIdentity(ctx)
+	if limited, retryAfter := failures.exhausted(client); limited {
+		return nil, rateLimitedError(ctx, retryAfter)
+	}
+
+	for _, value := range md.Get(authorizationKey) {
+		if tenant, ok := ks.tenant(bearerToken(value)); ok {
+			return withTenant(ctx, tenant), nil
+		}
+	}
+	failures.allow(client)
+	return nil, status.Error(codes.Unauthenticated, "invalid API key")
+}
+
+func bearerToken(value string) string {
+	if !strings.HasPrefix(value, bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(value[len(bearerPrefix):])
+}
+
+// authenticatedStream replaces the context of the stream with the authenticated one.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,231 @@
+package grpcbase
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func writeKeyFile(t *testing.T, dir string, content string) string {
+	keyFile := path.Join(dir, "keys")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte(content), 0600))
+	return keyFile
+}
+
+// callUnary calls the unary interceptors of s with the incoming metadata and returns the
+// tenant seen by the handler.
+func callUnary(s *Server, method string, md metadata.MD) (string, error) {
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	resp, err := chainUnaryInterceptors(s.unaryInterceptors)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		tenant, _ := Tenant(ctx)
+		return tenant, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.(string), nil
+}
+
+func TestReadKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ks, err := loadKeyStore(writeKeyFile(t, dir, "# tenant key\nacme key1\n\nacme key2\n  other  key3  \n"))
+	require.NoError(t, err)
+	for key, expected := range map[string]string{"key1": "acme", "key2": "acme", "key3": "other"} {
+		tenant, ok := ks.tenant(key)
+		assert.True(t, ok)
+		assert.Equal(t, expected, tenant)
+	}
+	_, ok := ks.tenant("key4")
+	assert.False(t, ok)
+	_, ok = ks.tenant("")
+	assert.False(t, ok)
+
+	for _, content := range []string{"", "# no keys\n", "acme\n", "acme key1 extra\n", "acme key1\nother key1\n"} {
+		_, err := loadKeyStore(writeKeyFile(t, dir, content))
+		assert.Error(t, err, content)
+	}
+	_, err = loadKeyStore(path.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestServerAuthenticatesGRPCRequests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := NewServer("", "test", "", nil)
+	require.NoError(t, s.SetAPIKeys(writeKeyFile(t, dir, "acme key1\n")))
+
+	tenant, err := callUnary(s, "/test.Service/Method", metadata.Pairs(authorizationKey, "Bearer key1"))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", tenant)
+
+	for _, md := range []metadata.MD{
+		nil,
+		metadata.Pairs(authorizationKey, "Bearer key2"),
+		metadata.Pairs(authorizationKey, "key1"),
+		metadata.Pairs(tenantKey, "acme"),
+	} {
+		_, err := callUnary(s, "/test.Service/Method", md)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), md)
+	}
+
+	_, err = callUnary(s, "/grpc.health.v1.Health/Check", nil)
+	assert.NoError(t, err, "health checks do not require a key")
+
+	tenant, err = callUnary(s, "/test.Service/Method", metadata.Pairs(selfTokenKey, s.selfToken, tenantKey, "acme"))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", tenant, "the tenant of requests forwarded by the gateway is trusted")
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestServerAuthenticatesGRPCStreams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := NewServer("", "test", "", nil)
+	require.NoError(t, s.SetAPIKeys(writeKeyFile(t, dir, "acme key1\n")))
+
+	stream := func(md metadata.MD) (string, error) {
+		var tenant string
+		err := chainStreamInterceptors(s.streamInterceptors)(nil, &fakeServerStream{ctx: metadata.NewIncomingContext(context.Background(), md)}, &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}, func(srv interface{}, stream grpc.ServerStream) error {
+			tenant, _ = Tenant(stream.Context())
+			return nil
+		})
+		return tenant, err
+	}
+
+	tenant, err := stream(metadata.Pairs(authorizationKey, "Bearer key1"))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", tenant)
+
+	_, err = stream(nil)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServerAuthenticatesHTTPRequests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := NewServer("", "test", "", nil)
+	require.NoError(t, s.SetAPIKeys(writeKeyFile(t, dir, "acme key1\n")))
+	s.SetRateLimit(RateLimit{Rate: 0.001, Burst: 1})
+
+	handler := s.wrapHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ := Tenant(r.Context())
+		w.Write([]byte(tenant))
+	}))
+	request := func(remoteAddr string, authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/range/00000", nil)
+		r.RemoteAddr = remoteAddr
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, request("192.0.2.1:1234", "Bearer key2").Code)
+
+	w = request("192.0.2.1:1234", "Bearer key1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "acme", w.Body.String())
+	assert.Equal(t, http.StatusTooManyRequests, request("192.0.2.2:1234", "Bearer key1").Code, "tenants are rate limited across addresses")
+}
+
+func TestServerRateLimitsFailedAuthentications(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := NewServer("", "test", "", nil)
+	require.NoError(t, s.SetAPIKeys(writeKeyFile(t, dir, "acme key1\n")))
+
+	for i := 0; i < authFailureBurst; i++ {
+		_, err := callUnary(s, "/test.Service/Method", metadata.Pairs(authorizationKey, "Bearer guess"))
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+	_, err = callUnary(s, "/test.Service/Method", metadata.Pairs(authorizationKey, "Bearer guess"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = callUnary(s, "/test.Service/Method", metadata.Pairs(authorizationKey, "Bearer key1"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "keys can not be guessed while limited")
+
+	handler := s.wrapHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/range/00000", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	for i := 0; i < authFailureBurst; i++ {
+		assert.Equal(t, http.StatusUnauthorized, request("192.0.2.1:1234").Code)
+	}
+	w := request("192.0.2.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusUnauthorized, request("192.0.2.2:1234").Code, "failures are limited by client address")
+}
+
+func TestServerReloadsAPIKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := NewServer("", "test", "", nil)
+	keyFile := writeKeyFile(t, dir, "acme key1\n")
+	require.NoError(t, s.SetAPIKeys(keyFile))
+
+	writeKeyFile(t, dir, "acme key2\n")
+	require.NoError(t, s.reload())
+	_, err = callUnary(s, "/test.Service/Method", metadata.Pairs(authorizationKey, "Bearer key1"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = callUnary(s, "/test.Service/Method", metadata.Pairs(authorizationKey, "Bearer key2"))
+	assert.NoError(t, err)
+
+	// Keys are kept if the file is invalid.
+	writeKeyFile(t, dir, "")
+	assert.Error(t, s.reload())
+	_, err = callUnary(s, "/test.Service/Method", metadata.Pairs(authorizationKey, "Bearer key2"))
+	assert.NoError(t, err)
+}
+
+func TestSelfCredentialsForwardTenant(t *testing.T) {
+	c := selfCredentials{token: "token"}
+
+	md, err := c.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{selfTokenKey: "token"}, md)
+
+	md, err = c.GetRequestMetadata(withTenant(context.Background(), "acme"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{selfTokenKey: "token", tenantKey: "acme"}, md)
+}
@@ -0,0 +1,139 @@
+package grpcbase
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// GatewayConfig configures the HTTP gateway served next to the gRPC server.
+type GatewayConfig struct {
+	ListenOn string
+	// CertFile and KeyFile are paths of the PEM encoded certificate and key. The
+	// gateway is served over TLS if both are set.
+	CertFile string
+	KeyFile  string
+
+	// ReadTimeout, WriteTimeout and IdleTimeout limit the duration of reading a request,
+	// writing a response and keeping an idle connection open. Zero means no limit.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout is how long in-flight requests are waited for on shutdown.
+	ShutdownTimeout time.Duration
+}
+
+func (c GatewayConfig) tls() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// GatewayHandlerFunc creates the handler of the gateway. It is called with a connection
+// to the gRPC server and a context that is cancelled when the server stops.
+type GatewayHandlerFunc func(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error)
+
+// gateway is the HTTP server of the gateway.
+type gateway struct {
+	config  GatewayConfig
+	handler GatewayHandlerFunc
+	// wrap optionally wraps the created handler with middleware.
+	wrap func(http.Handler) http.Handler
+	// certs is the certificate of the gateway if it is served over TLS.
+	certs *certificates
+
+	lis    net.Listener
+	server *http.Server
+	cancel context.CancelFunc
+}
+
+// SetGateway serves an HTTP gateway created by handler next to the gRPC server. The
+// gateway is stopped together with the gRPC server. Its certificate is reloaded on SIGHUP.
+func (s *Server) SetGateway(config GatewayConfig, handler GatewayHandlerFunc) {
+	s.gateway = &gateway{config: config, handler: handler}
+	if config.tls() {
+		s.gateway.certs = &certificates{config: TLSConfig{CertFile: config.CertFile, KeyFile: config.KeyFile}}
+		s.OnReload(s.gateway.certs.reload)
+	}
+}
+
+// listen listens on the address of the gateway so listening errors are reported
+// before anything is served.
+func (g *gateway) listen() error {
+	if (g.config.CertFile == "") != (g.config.KeyFile == "") {
+		return errors.New("both certificate and key are required for gateway TLS")
+	}
+
+	if g.config.tls() {
+		if g.certs == nil {
+			g.certs = &certificates{config: TLSConfig{CertFile: g.config.CertFile, KeyFile: g.config.KeyFile}}
+		}
+		if err := g.certs.reload(); err != nil {
+			return errors.WithMessage(err, "loading gateway certificate failed")
+		}
+	}
+
+	lis, err := net.Listen("tcp", g.config.ListenOn)
+	if err != nil {
+		return errors.WithMessage(err, "gateway failed to listen")
+	}
+	g.lis = lis
+	return nil
+}
+
+// init creates the handler of the gateway with a connection to the gRPC server.
+func (g *gateway) init(conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	handler, err := g.handler(ctx, conn)
+	if err != nil {
+		cancel()
+		g.lis.Close()
+		return errors.WithMessage(err, "creating gateway handler failed")
+	}
+	if g.wrap != nil {
+		handler = g.wrap(handler)
+	}
+
+	g.cancel = cancel
+	g.server = &http.Server{
+		Handler:      handler,
+		ReadTimeout:  g.config.ReadTimeout,
+		WriteTimeout: g.config.WriteTimeout,
+		IdleTimeout:  g.config.IdleTimeout,
+	}
+	return nil
+}
+
+// serve serves the gateway until it is shut down. The returned error is nil if the
+// gateway was shut down.
+func (g *gateway) serve() error {
+	var err error
+	if g.certs != nil {
+		// The certificate is taken from the TLS config so reloading it affects new connections.
+		g.server.TLSConfig = g.certs.serverConfig()
+		err = g.server.ServeTLS(g.lis, "", "")
+	} else {
+		err = g.server.Serve(g.lis)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// shutdown stops accepting requests and waits for in-flight requests to finish for
+// at most the shutdown timeout.
+func (g *gateway) shutdown() error {
+	defer g.cancel()
+
+	ctx := context.Background()
+	if g.config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.config.ShutdownTimeout)
+		defer cancel()
+	}
+	return g.server.Shutdown(ctx)
+}
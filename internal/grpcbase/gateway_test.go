@@ -0,0 +1,147 @@
+package grpcbase
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/arjantop/pwned-passwords/internal/grpctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func startGateway(t *testing.T, config GatewayConfig, handler http.Handler) (*gateway, <-chan error) {
+	config.ListenOn = "127.0.0.1:0"
+	g := &gateway{config: config, handler: func(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+		return handler, nil
+	}}
+	require.NoError(t, g.listen())
+	require.NoError(t, g.init(nil))
+
+	served := make(chan error, 1)
+	go func() {
+		served <- g.serve()
+	}()
+	return g, served
+}
+
+func TestGatewayShutdownWaitsForInFlightRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	g, served := startGateway(t, GatewayConfig{ShutdownTimeout: 5 * time.Second}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	}))
+
+	type response struct {
+		resp *http.Response
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.Get("http://" + g.lis.Addr().String())
+		responses <- response{resp, err}
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- g.shutdown()
+	}()
+	assert.NoError(t, <-served)
+
+	close(release)
+	r := <-responses
+	if assert.NoError(t, r.err) {
+		body, _ := ioutil.ReadAll(r.resp.Body)
+		r.resp.Body.Close()
+		assert.Equal(t, "done", string(body))
+	}
+	assert.NoError(t, <-shutdown)
+
+	_, err := http.Get("http://" + g.lis.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestGatewayServesTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gateway")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certs := grpctest.WriteCertificates(dir)
+	g, _ := startGateway(t, GatewayConfig{CertFile: certs.ServerCertFile, KeyFile: certs.ServerKeyFile}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotNil(t, r.TLS)
+	}))
+	defer g.shutdown()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + g.lis.Addr().String())
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+// gatewayCertificate returns the certificate presented by the gateway on a new connection.
+func gatewayCertificate(t *testing.T, g *gateway) []byte {
+	conn, err := tls.Dial("tcp", g.lis.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Raw
+}
+
+func certificateFile(t *testing.T, certFile string, keyFile string) []byte {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	return cert.Certificate[0]
+}
+
+func TestGatewayReloadsCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gateway")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certs := grpctest.WriteCertificates(dir)
+	s := NewServer("", "test", "", nil)
+	s.SetGateway(GatewayConfig{ListenOn: "127.0.0.1:0", CertFile: certs.ServerCertFile, KeyFile: certs.ServerKeyFile}, func(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+		return http.NotFoundHandler(), nil
+	})
+	g := s.gateway
+	require.NoError(t, g.listen())
+	require.NoError(t, g.init(nil))
+	go g.serve()
+	defer g.shutdown()
+
+	old := certificateFile(t, certs.ServerCertFile, certs.ServerKeyFile)
+	assert.Equal(t, old, gatewayCertificate(t, g))
+
+	grpctest.WriteCertificates(dir)
+	assert.Equal(t, old, gatewayCertificate(t, g), "the certificate is only replaced on reload")
+
+	require.NoError(t, s.reload())
+	rotated := certificateFile(t, certs.ServerCertFile, certs.ServerKeyFile)
+	assert.NotEqual(t, old, rotated)
+	assert.Equal(t, rotated, gatewayCertificate(t, g))
+}
+
+func TestGatewayFailsWithIncompleteTLSConfig(t *testing.T) {
+	g := &gateway{config: GatewayConfig{ListenOn: "127.0.0.1:0", CertFile: "cert.pem"}}
+	assert.Error(t, g.listen())
+}
+
+func TestGatewayFailsIfHandlerCanNotBeCreated(t *testing.T) {
+	g := &gateway{
+		config: GatewayConfig{ListenOn: "127.0.0.1:0"},
+		handler: func(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+			return nil, errors.New("no handler")
+		},
+	}
+	require.NoError(t, g.listen())
+	assert.EqualError(t, g.init(nil), "creating gateway handler failed: no handler")
+}
@@ -0,0 +1,176 @@
+package grpcbase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// readinessCheckInterval is the interval in which readiness is checked for the gRPC health service.
+	readinessCheckInterval = 10 * time.Second
+	// readinessCheckTimeout bounds the time all readiness checks may take.
+	readinessCheckTimeout = 5 * time.Second
+)
+
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// readiness tracks whether the server is ready to serve requests and reports it to
+// the gRPC health service.
+type readiness struct {
+	checks []readinessCheck
+	health *health.Server
+
+	mu       sync.Mutex
+	services []string
+	stopping bool
+	// checked is set after the first check, lastErr is the result of the last check.
+	checked bool
+	lastErr error
+
+	// done is closed when the server is stopping to stop periodic checks.
+	done chan struct{}
+}
+
+func newReadiness() *readiness {
+	r := &readiness{health: health.NewServer(), done: make(chan struct{})}
+	// Nothing is served until the first check passes.
+	r.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return r
+}
+
+// OnReadinessCheck registers a check that must pass for the server to be reported as
+// ready. Checks are called periodically and /readyz reports the result of the last
+// check so probes do not cause load on the checked dependencies.
+func (s *Server) OnReadinessCheck(name string, check func(ctx context.Context) error) {
+	s.readiness.checks = append(s.readiness.checks, readinessCheck{name: name, check: check})
+}
+
+// register registers the health service on the server. Health of all services of the
+// server is reported together with the health of the server itself.
+func (r *readiness) register(server *grpc.Server) {
+	r.mu.Lock()
+	for name := range server.GetServiceInfo() {
+		r.services = append(r.services, name)
+		r.health.SetServingStatus(name, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	r.mu.Unlock()
+
+	healthpb.RegisterHealthServer(server, r.health)
+}
+
+// check calls all readiness checks and updates the health status with the result.
+func (r *readiness) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	var err error
+	for _, c := range r.checks {
+		if err = c.check(ctx); err != nil {
+			err = errors.WithMessagef(err, "%s is not ready", c.name)
+			break
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopping {
+		return errors.New("server is stopping")
+	}
+	r.checked = true
+	r.lastErr = err
+
+	status := healthpb.HealthCheckResponse_SERVING
+	if err != nil {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	r.health.SetServingStatus("", status)
+	for _, name := range r.services {
+		r.health.SetServingStatus(name, status)
+	}
+	return err
+}
+
+// stop reports all services as not serving so clients stop sending new requests.
+func (r *readiness) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stopping {
+		r.stopping = true
+		close(r.done)
+	}
+	r.health.Shutdown()
+}
+
+// checkPeriodically checks readiness until the server is stopping.
+func (r *readiness) checkPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Only changes of the state are logged.
+	var lastState string
+	for {
+		err := r.check(context.Background())
+
+		state := "ready"
+		if err != nil {
+			state = err.Error()
+		}
+		if state != lastState {
+			if err != nil {
+				log.Printf("Server is not ready: %v", err)
+			} else {
+				log.Println("Server is ready")
+			}
+		}
+		lastState = state
+
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleHealthz reports that the process is alive.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz reports whether all readiness checks passed on the last check. Checks
+// are only called if they have not been called yet.
+func (r *readiness) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	if err := r.lastResult(req.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// lastResult returns the result of the last check or checks readiness if it was never checked.
+func (r *readiness) lastResult(ctx context.Context) error {
+	r.mu.Lock()
+	stopping, checked, err := r.stopping, r.checked, r.lastErr
+	r.mu.Unlock()
+
+	switch {
+	case stopping:
+		return errors.New("server is stopping")
+	case !checked:
+		return r.check(ctx)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,108 @@
+package grpcbase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func servingStatus(t *testing.T, r *readiness, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := r.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if !assert.NoError(t, err) {
+		return healthpb.HealthCheckResponse_UNKNOWN
+	}
+	return resp.Status
+}
+
+func readyz(r *readiness) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.handleReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return w
+}
+
+func TestServerIsReadyOnlyIfAllReadinessChecksPass(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+
+	dataErr := errors.New("no data")
+	s.OnReadinessCheck("first", func(ctx context.Context) error { return nil })
+	s.OnReadinessCheck("data", func(ctx context.Context) error { return dataErr })
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{ServiceName: "test.Service", HandlerType: (*interface{})(nil)}, struct{}{})
+	s.readiness.register(srv)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, s.readiness, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, s.readiness, "test.Service"))
+
+	w := readyz(s.readiness)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "data is not ready: no data")
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, s.readiness, ""))
+
+	dataErr = nil
+	assert.Equal(t, http.StatusServiceUnavailable, readyz(s.readiness).Code, "the result of the last check is reported")
+	assert.NoError(t, s.readiness.check(context.Background()))
+	w = readyz(s.readiness)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, servingStatus(t, s.readiness, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, servingStatus(t, s.readiness, "test.Service"))
+
+	s.readiness.stop()
+	assert.Equal(t, http.StatusServiceUnavailable, readyz(s.readiness).Code)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, s.readiness, ""))
+}
+
+func TestReadyzChecksOnlyIfNeverChecked(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+
+	var checks int
+	s.OnReadinessCheck("counted", func(ctx context.Context) error {
+		checks++
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, readyz(s.readiness).Code)
+	}
+	assert.Equal(t, 1, checks)
+}
+
+func TestPeriodicReadinessChecksStopWhenServerStops(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+
+	checked := make(chan struct{}, 1)
+	s.OnReadinessCheck("signalling", func(ctx context.Context) error {
+		select {
+		case checked <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.readiness.checkPeriodically(time.Millisecond)
+		close(done)
+	}()
+	<-checked
+
+	s.readiness.stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("periodic checks did not stop")
+	}
+	s.readiness.stop()
+}
+
+func TestHealthzReportsAliveProcess(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleHealthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,133 @@
+package grpcbase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// selfTokenKey is the metadata key of the token sent on connections of the server to itself.
+const selfTokenKey = "x-grpcbase-self"
+
+// selfCredentials marks requests of the server to itself, for example requests
+// forwarded by the gateway, with a random token only known to the server. The tenant
+// of requests authenticated by the gateway is forwarded with them.
+type selfCredentials struct {
+	token string
+}
+
+func newSelfToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic("generating token failed: " + err.Error())
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (c selfCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md := map[string]string{selfTokenKey: c.token}
+	if tenant, ok := Tenant(ctx); ok {
+		md[tenantKey] = tenant
+	}
+	return md, nil
+}
+
+func (c selfCredentials) RequireTransportSecurity() bool {
+	// Connections of the server to itself never leave the host.
+	return false
+}
+
+// isSelf reports whether the request was made by the server itself.
+func (s *Server) isSelf(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, token := range md.Get(selfTokenKey) {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.selfToken)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context that identifies the client of the request with id.
+// Interceptors and middleware that authenticate clients use it to make the identity
+// take precedence over the one derived from the connection.
+func WithIdentity(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// ClientIdentity identifies the client of a gRPC request. Clients are identified by
+// the identity set with WithIdentity, the common name of their verified certificate
+// or their IP address, in that order. IPv6 clients are identified by their /64 prefix
+// because they usually control all addresses in it.
+func ClientIdentity(ctx context.Context) string {
+	if id, ok := ctx.Value(identityKey{}).(string); ok {
+		return id
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		if id := certificateIdentity(&info.State); id != "" {
+			return id
+		}
+	}
+	return ipIdentity(hostOf(p.Addr.String()))
+}
+
+// HTTPClientIdentity identifies the client of an HTTP request like ClientIdentity.
+func HTTPClientIdentity(r *http.Request) string {
+	if id, ok := r.Context().Value(identityKey{}).(string); ok {
+		return id
+	}
+	if r.TLS != nil {
+		if id := certificateIdentity(r.TLS); id != "" {
+			return id
+		}
+	}
+	return ipIdentity(hostOf(r.RemoteAddr))
+}
+
+// certificateIdentity returns the identity of the client certificate. Certificates
+// are only presented if the server requires mutual TLS, in which case they are verified.
+func certificateIdentity(state *tls.ConnectionState) string {
+	if len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return "cert:" + state.PeerCertificates[0].Subject.CommonName
+}
+
+// ipv6PrefixLength is the length of the IPv6 prefix that identifies a client.
+const ipv6PrefixLength = 64
+
+func ipIdentity(host string) string {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "ip:" + host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return "ip:" + ip4.String()
+	}
+	mask := net.CIDRMask(ipv6PrefixLength, 8*net.IPv6len)
+	return fmt.Sprintf("ip:%s/%d", ip.Mask(mask), ipv6PrefixLength)
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
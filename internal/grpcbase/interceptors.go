@@ -0,0 +1,72 @@
+package grpcbase
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+)
+
+// AddInterceptors adds interceptors to all gRPC servers. Either of them can be nil.
+// Interceptors are called in the order they were added.
+func (s *Server) AddInterceptors(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) {
+	if unary != nil {
+		s.unaryInterceptors = append(s.unaryInterceptors, unary)
+	}
+	if stream != nil {
+		s.streamInterceptors = append(s.streamInterceptors, stream)
+	}
+}
+
+// AddHTTPMiddleware wraps the handler of the gateway. Middleware added first is
+// called first.
+func (s *Server) AddHTTPMiddleware(middleware func(http.Handler) http.Handler) {
+	s.httpMiddleware = append(s.httpMiddleware, middleware)
+}
+
+// interceptorOptions returns server options installing the chained interceptors.
+// A server only accepts a single interceptor of each kind.
+func (s *Server) interceptorOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if len(s.unaryInterceptors) > 0 {
+		opts = append(opts, grpc.UnaryInterceptor(chainUnaryInterceptors(s.unaryInterceptors)))
+	}
+	if len(s.streamInterceptors) > 0 {
+		opts = append(opts, grpc.StreamInterceptor(chainStreamInterceptors(s.streamInterceptors)))
+	}
+	return opts
+}
+
+func chainUnaryInterceptors(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, inner)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+func chainStreamInterceptors(interceptors []grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(srv interface{}, stream grpc.ServerStream) error {
+				return interceptor(srv, stream, info, inner)
+			}
+		}
+		return next(srv, stream)
+	}
+}
+
+// wrapHandler wraps the handler with all HTTP middleware.
+func (s *Server) wrapHandler(handler http.Handler) http.Handler {
+	for i := len(s.httpMiddleware) - 1; i >= 0; i-- {
+		handler = s.httpMiddleware[i](handler)
+	}
+	return handler
+}
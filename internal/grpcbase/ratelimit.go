@@ -0,0 +1,270 @@
+package grpcbase
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	rateLimited = stats.Int64("pwnedpasswords/rate_limited", "Number of requests rejected by the rate limiter", stats.UnitDimensionless)
+
+	keyProtocol, _ = tag.NewKey("protocol")
+
+	RateLimitedCountView = &view.View{
+		Name:        "pwnedpasswords/rate_limited_count",
+		Description: "Count of requests rejected by the rate limiter by protocol",
+		Measure:     rateLimited,
+		TagKeys:     []tag.Key{keyProtocol},
+		Aggregation: view.Count(),
+	}
+
+	RateLimitViews = []*view.View{
+		RateLimitedCountView,
+	}
+)
+
+// retryAfterKey is the header with the number of seconds after which a rejected request can be retried.
+const retryAfterKey = "retry-after"
+
+// sweepInterval is the interval in which buckets of clients that are no longer limited are removed.
+const sweepInterval = time.Minute
+
+// maxBuckets bounds the number of clients tracked at once so many distinct clients can
+// not exhaust memory.
+const maxBuckets = 100000
+
+// RateLimit configures per-client rate limiting of requests.
+type RateLimit struct {
+	// Rate is the number of requests per second a client can make on average.
+	Rate float64
+	// Burst is the number of requests a client can make at once.
+	Burst int
+	// MeteredMethods are full names of streaming methods, like "/package.Service/Method",
+	// for which every sent message counts as a request. They are meant for methods that
+	// stream bulk data in response to a single request.
+	MeteredMethods []string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter limits requests of every client with a token bucket. Every request takes a
+// token from the bucket of its client and is rejected if there is none left. Buckets
+// are refilled at the configured rate up to the burst size.
+type limiter struct {
+	rate       float64
+	burst      float64
+	maxBuckets int
+	now        func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newLimiter(config RateLimit) *limiter {
+	return &limiter{
+		rate:       config.Rate,
+		burst:      math.Max(float64(config.Burst), 1),
+		maxBuckets: maxBuckets,
+		now:        time.Now,
+		buckets:    make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the bucket of the client. If there is none left it returns
+// false and the time after which a token will be available.
+func (l *limiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		l.makeRoom(now)
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *limiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
+
+// sweep removes full buckets. They are equivalent to buckets of new clients.
+func (l *limiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// exhausted reports whether the client has no tokens left without taking one and the
+// time after which a token will be available.
+func (l *limiter) exhausted(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		return false, 0
+	}
+	tokens := l.refill(b, l.now())
+	if tokens < 1 {
+		return true, time.Duration((1 - tokens) / l.rate * float64(time.Second))
+	}
+	return false, 0
+}
+
+// makeRoom removes buckets if there are too many. Full buckets are removed first and
+// then arbitrary ones, which only gives their clients their burst again.
+func (l *limiter) makeRoom(now time.Time) {
+	if len(l.buckets) < l.maxBuckets {
+		return
+	}
+	l.sweep(now)
+	for client := range l.buckets {
+		if len(l.buckets) < l.maxBuckets {
+			break
+		}
+		delete(l.buckets, client)
+	}
+}
+
+// retryAfterSeconds rounds the duration up to whole seconds as used by the Retry-After header.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func recordRateLimited(ctx context.Context, protocol string) {
+	ctx, _ = tag.New(ctx, tag.Upsert(keyProtocol, protocol))
+	stats.Record(ctx, rateLimited.M(1))
+}
+
+// SetRateLimit limits the rate of requests of every client as identified by ClientIdentity
+// and HTTPClientIdentity. Rejected gRPC requests fail with ResourceExhausted and HTTP
+// requests with 429 Too Many Requests, both with the Retry-After header set.
+//
+// Every message received on a stream counts as a request so streams can not be used to
+// avoid the limit, and so does every message sent on streams of config.MeteredMethods.
+// Requests forwarded by the gateway are only limited by the gateway. Health checks are
+// not limited so probes can not be throttled out of readiness.
+func (s *Server) SetRateLimit(config RateLimit) {
+	l := newLimiter(config)
+	metered := make(map[string]bool, len(config.MeteredMethods))
+	for _, method := range config.MeteredMethods {
+		metered[method] = true
+	}
+
+	s.AddInterceptors(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+				return handler(ctx, req)
+			}
+			if err := s.checkRateLimit(ctx, l); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		},
+		func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+				return handler(srv, stream)
+			}
+			return handler(srv, &rateLimitedStream{
+				ServerStream: stream,
+				server:       s,
+				limiter:      l,
+				metered:      metered[info.FullMethod],
+			})
+		},
+	)
+
+	s.AddHTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, retryAfter := l.allow(HTTPClientIdentity(r)); !ok {
+				writeRateLimited(w, r, retryAfter)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+func (s *Server) checkRateLimit(ctx context.Context, l *limiter) error {
+	if s.isSelf(ctx) {
+		return nil
+	}
+	if ok, retryAfter := l.allow(ClientIdentity(ctx)); !ok {
+		return rateLimitedError(ctx, retryAfter)
+	}
+	return nil
+}
+
+// rateLimitedError records a rejected gRPC request and returns its error.
+func rateLimitedError(ctx context.Context, retryAfter time.Duration) error {
+	recordRateLimited(ctx, "grpc")
+	seconds := retryAfterSeconds(retryAfter)
+	grpc.SetHeader(ctx, metadata.Pairs(retryAfterKey, seconds))
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %s seconds", seconds)
+}
+
+// writeRateLimited records a rejected HTTP request and writes its response.
+func writeRateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	recordRateLimited(r.Context(), "http")
+	w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+}
+
+// rateLimitedStream takes a token for every received message and, if metered, for
+// every sent message.
+type rateLimitedStream struct {
+	grpc.ServerStream
+	server  *Server
+	limiter *limiter
+	metered bool
+}
+
+func (s *rateLimitedStream) SendMsg(m interface{}) error {
+	if s.metered {
+		if err := s.server.checkRateLimit(s.Context(), s.limiter); err != nil {
+			return err
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *rateLimitedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.server.checkRateLimit(s.Context(), s.limiter)
+}
@@ -0,0 +1,224 @@
+package grpcbase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLimiterRefillsBucketsAtRate(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(RateLimit{Rate: 2, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	ok, _ := l.allow("a")
+	assert.True(t, ok)
+	ok, _ = l.allow("a")
+	assert.True(t, ok)
+	ok, retryAfter := l.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	ok, _ = l.allow("b")
+	assert.True(t, ok, "clients have their own buckets")
+
+	now = now.Add(250 * time.Millisecond)
+	ok, retryAfter = l.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 250*time.Millisecond, retryAfter)
+
+	now = now.Add(250 * time.Millisecond)
+	ok, _ = l.allow("a")
+	assert.True(t, ok)
+	ok, _ = l.allow("a")
+	assert.False(t, ok)
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		ok, _ = l.allow("a")
+		assert.True(t, ok, "tokens are not accumulated above the burst size")
+	}
+	ok, _ = l.allow("a")
+	assert.False(t, ok)
+}
+
+func TestLimiterRemovesFullBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(RateLimit{Rate: 1, Burst: 10})
+	l.now = func() time.Time { return now }
+
+	l.allow("a")
+	now = now.Add(5 * time.Second)
+	l.allow("b")
+	assert.Len(t, l.buckets, 2)
+
+	now = now.Add(sweepInterval)
+	l.allow("b")
+	assert.Len(t, l.buckets, 1)
+	assert.Contains(t, l.buckets, "b")
+}
+
+func TestLimiterBoundsNumberOfBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(RateLimit{Rate: 1, Burst: 10})
+	l.maxBuckets = 3
+	l.now = func() time.Time { return now }
+
+	for _, client := range []string{"a", "b", "c", "d", "e"} {
+		ok, _ := l.allow(client)
+		assert.True(t, ok)
+		assert.True(t, len(l.buckets) <= 3)
+	}
+
+	// Full buckets are removed before limited ones.
+	l.buckets = make(map[string]*bucket)
+	for i := 0; i < 10; i++ {
+		l.allow("limited")
+	}
+	now = now.Add(time.Millisecond)
+	l.allow("a")
+	now = now.Add(5 * time.Second)
+	l.allow("b")
+	l.allow("c")
+	assert.Len(t, l.buckets, 3)
+	assert.Contains(t, l.buckets, "limited")
+	assert.NotContains(t, l.buckets, "a")
+}
+
+func TestRetryAfterSecondsRoundsUp(t *testing.T) {
+	assert.Equal(t, "1", retryAfterSeconds(time.Millisecond))
+	assert.Equal(t, "1", retryAfterSeconds(time.Second))
+	assert.Equal(t, "2", retryAfterSeconds(1500*time.Millisecond))
+}
+
+func TestServerRateLimitsGRPCRequests(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+	s.SetRateLimit(RateLimit{Rate: 0.001, Burst: 1})
+
+	_, err := callUnary(s, "/test.Service/Method", nil)
+	assert.NoError(t, err)
+	_, err = callUnary(s, "/test.Service/Method", nil)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = callUnary(s, "/test.Service/Method", metadata.Pairs(selfTokenKey, s.selfToken))
+	assert.NoError(t, err, "requests forwarded by the gateway are not limited twice")
+	_, err = callUnary(s, "/test.Service/Method", metadata.Pairs(selfTokenKey, "guessed"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestServerDoesNotRateLimitHealthChecks(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+	s.SetRateLimit(RateLimit{Rate: 0.001, Burst: 1})
+
+	addr, stop := serveTLS(t, s)
+	defer stop()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, check(addr, grpc.WithInsecure()))
+	}
+}
+
+// countingServerStream accepts all messages and counts the sent ones.
+type countingServerStream struct {
+	fakeServerStream
+	sent int
+}
+
+func (s *countingServerStream) SendMsg(m interface{}) error {
+	s.sent++
+	return nil
+}
+
+func (s *countingServerStream) RecvMsg(m interface{}) error {
+	return nil
+}
+
+// callStream calls the stream interceptors of the server and then the handler with
+// the intercepted stream.
+func callStream(s *Server, method string, handler grpc.StreamHandler) (*countingServerStream, error) {
+	stream := &countingServerStream{fakeServerStream: fakeServerStream{ctx: context.Background()}}
+	err := chainStreamInterceptors(s.streamInterceptors)(nil, stream, &grpc.StreamServerInfo{FullMethod: method}, handler)
+	return stream, err
+}
+
+func TestServerRateLimitsReceivedStreamMessages(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+	s.SetRateLimit(RateLimit{Rate: 0.001, Burst: 2})
+
+	stream, err := callStream(s, "/test.Service/Stream", func(srv interface{}, stream grpc.ServerStream) error {
+		for i := 0; i < 3; i++ {
+			if err := stream.SendMsg(i); err != nil {
+				return err
+			}
+		}
+		for {
+			if err := stream.RecvMsg(nil); err != nil {
+				return err
+			}
+		}
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, 3, stream.sent, "sent messages of streams that are not metered are not limited")
+}
+
+func TestServerRateLimitsSentMessagesOfMeteredStreams(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+	s.SetRateLimit(RateLimit{Rate: 0.001, Burst: 3, MeteredMethods: []string{"/test.Service/Download"}})
+
+	stream, err := callStream(s, "/test.Service/Download", func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(nil); err != nil {
+			return err
+		}
+		for i := 0; ; i++ {
+			if err := stream.SendMsg(i); err != nil {
+				return err
+			}
+		}
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, 2, stream.sent, "the received request and sent messages take tokens")
+}
+
+func TestServerRateLimitsHTTPRequests(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+	s.SetRateLimit(RateLimit{Rate: 0.5, Burst: 1})
+	handler := s.wrapHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/range/00000", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("192.0.2.1:1234").Code)
+	w := request("192.0.2.1:5678")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, request("192.0.2.2:1234").Code)
+}
+
+func TestHTTPClientIdentity(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal(t, "ip:192.0.2.1", HTTPClientIdentity(r))
+
+	r.RemoteAddr = "[2001:db8:1:2:3:4:5:6]:1234"
+	assert.Equal(t, "ip:2001:db8:1:2::/64", HTTPClientIdentity(r))
+	r.RemoteAddr = "[2001:db8:1:2:ffff::1]:1234"
+	assert.Equal(t, "ip:2001:db8:1:2::/64", HTTPClientIdentity(r), "addresses in the same /64 are the same client")
+	r.RemoteAddr = "[::ffff:192.0.2.1]:1234"
+	assert.Equal(t, "ip:192.0.2.1", HTTPClientIdentity(r))
+
+	r = r.WithContext(WithIdentity(r.Context(), "key:test"))
+	assert.Equal(t, "key:test", HTTPClientIdentity(r))
+}
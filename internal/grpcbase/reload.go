@@ -0,0 +1,68 @@
+package grpcbase
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	reloads = stats.Int64("pwnedpasswords/reloads", "Number of reloads triggered by SIGHUP", stats.UnitDimensionless)
+
+	keyReloadResult, _ = tag.NewKey("result")
+
+	ReloadCountView = &view.View{
+		Name:        "pwnedpasswords/reload_count",
+		Description: "Count of reloads by result",
+		Measure:     reloads,
+		TagKeys:     []tag.Key{keyReloadResult},
+		Aggregation: view.Count(),
+	}
+)
+
+// OnReload registers a function that is called when the server receives SIGHUP.
+// Reload functions are called in the order they were registered. A failing function
+// does not prevent the others from being called.
+func (s *Server) OnReload(f func() error) {
+	s.reloadFuncs = append(s.reloadFuncs, f)
+}
+
+// reload calls all registered reload functions and records the result. The returned
+// error combines the errors of all failed functions.
+func (s *Server) reload() error {
+	var messages []string
+	for _, f := range s.reloadFuncs {
+		if err := f(); err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+	if len(messages) > 0 {
+		recordReload("failure")
+		return errors.New(strings.Join(messages, "; "))
+	}
+	recordReload("success")
+	return nil
+}
+
+func recordReload(result string) {
+	ctx, _ := tag.New(context.Background(), tag.Upsert(keyReloadResult, result))
+	stats.Record(ctx, reloads.M(1))
+}
+
+func (s *Server) handleReloads(signals <-chan os.Signal) {
+	for range signals {
+		log.Println("Reloading ...")
+		if err := s.reload(); err != nil {
+			log.Printf("Reload failed: %v", err)
+			continue
+		}
+		log.Println("Reload succeeded")
+	}
+}
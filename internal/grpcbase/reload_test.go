@@ -0,0 +1,38 @@
+package grpcbase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerReloadCallsAllReloadFuncsInOrder(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+
+	var called []int
+	s.OnReload(func() error {
+		called = append(called, 1)
+		return nil
+	})
+	s.OnReload(func() error {
+		called = append(called, 2)
+		return errors.New("reload failed")
+	})
+	s.OnReload(func() error {
+		called = append(called, 3)
+		return nil
+	})
+	s.OnReload(func() error {
+		called = append(called, 4)
+		return errors.New("other reload failed")
+	})
+
+	assert.EqualError(t, s.reload(), "reload failed; other reload failed")
+	assert.Equal(t, []int{1, 2, 3, 4}, called)
+
+	called = nil
+	s.reloadFuncs = s.reloadFuncs[:1]
+	assert.NoError(t, s.reload())
+	assert.Equal(t, []int{1}, called)
+}
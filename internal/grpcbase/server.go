@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/arjantop/pwned-passwords/internal/monitoring"
 	"github.com/pkg/errors"
@@ -21,21 +23,48 @@ type Server struct {
 	jaegerEndpoint string
 	init           func(server *grpc.Server)
 	flusher        monitoring.FlushFunc
+	reloadFuncs    []func() error
+	listeners      []listener
+	gateway        *gateway
+	certificates   *certificates
+	readiness      *readiness
+
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+	httpMiddleware     []func(http.Handler) http.Handler
+	selfToken          string
 
 	started bool
 }
 
+// listener is an additional address with its own set of services.
+type listener struct {
+	listenOn string
+	init     func(server *grpc.Server)
+}
+
 func NewServer(listenOn string, name string, jaegerEndpoint string, init func(server *grpc.Server)) *Server {
 	return &Server{
 		listenOn:       listenOn,
 		name:           name,
 		jaegerEndpoint: jaegerEndpoint,
 		init:           init,
+		readiness:      newReadiness(),
+		selfToken:      newSelfToken(),
 	}
 }
 
+// AddListener serves the services registered by init on an additional address.
+// Services are only reachable on the listener they are registered for, so this can
+// be used to expose services only to trusted networks.
+func (s *Server) AddListener(listenOn string, init func(server *grpc.Server)) {
+	s.listeners = append(s.listeners, listener{listenOn: listenOn, init: init})
+}
+
 func (s *Server) StartWithClient(f func(conn *grpc.ClientConn)) error {
 	http.Handle("/debug/", http.StripPrefix("/debug", zpages.Handler))
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", s.readiness.handleReadyz)
 
 	if err := s.setUpMonitoring(); err != nil {
 		return err
@@ -45,37 +74,114 @@ func (s *Server) StartWithClient(f func(conn *grpc.ClientConn)) error {
 	if err != nil {
 		return errors.WithMessage(err, "failed to listen")
 	}
+	if s.gateway != nil {
+		if err := s.gateway.listen(); err != nil {
+			return err
+		}
+	}
 
 	log.Println("Starting server ...")
-	srv := grpc.NewServer(grpc.StatsHandler(&ocgrpc.ServerHandler{}))
+	srv := grpc.NewServer(append(s.serverOptions(), grpc.StatsHandler(&ocgrpc.ServerHandler{}))...)
 
 	s.init(srv)
+	s.readiness.register(srv)
+
+	servers := []*grpc.Server{srv}
+	for _, l := range s.listeners {
+		extraLis, err := net.Listen("tcp", l.listenOn)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to listen on %s", l.listenOn)
+		}
+
+		extraSrv := grpc.NewServer(append(s.serverOptions(), grpc.StatsHandler(&ocgrpc.ServerHandler{}))...)
+		l.init(extraSrv)
+		s.readiness.register(extraSrv)
+		servers = append(servers, extraSrv)
+
+		go func() {
+			// Serve only returns nil after the server is stopped.
+			if err := extraSrv.Serve(extraLis); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if f != nil || s.gateway != nil {
+		conn, err := grpc.Dial(lis.Addr().String(),
+			grpc.WithStatsHandler(&ocgrpc.ClientHandler{}),
+			s.selfDialOption(),
+			grpc.WithPerRPCCredentials(selfCredentials{token: s.selfToken}))
+		if err != nil {
+			return errors.WithMessage(err, "could not dial")
+		}
+		defer conn.Close()
+
+		if f != nil {
+			f(conn)
+		}
+		if s.gateway != nil {
+			s.gateway.wrap = s.wrapHandler
+			if err := s.gateway.init(conn); err != nil {
+				return err
+			}
+		}
+	}
+
+	var stopOnce sync.Once
+	stop := func() {
+		stopOnce.Do(func() {
+			log.Println("Stopping server ...")
+			s.readiness.stop()
+			// The gateway is stopped first because its requests are served by the gRPC server.
+			if s.gateway != nil {
+				if err := s.gateway.shutdown(); err != nil {
+					log.Printf("Gateway shutdown failed: %v", err)
+				}
+			}
+			for _, server := range servers {
+				server.GracefulStop()
+			}
+		})
+	}
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-c
-		log.Println("Stopping server ...")
-		srv.GracefulStop()
+		stop()
 	}()
 
+	// Reloading keeps the listener and all connections open.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go s.handleReloads(hup)
+
+	go s.readiness.checkPeriodically(readinessCheckInterval)
+
 	s.started = true
 
 	go func() {
 		log.Fatal(http.ListenAndServe(":6060", nil))
 	}()
 
-	if f != nil {
-		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithStatsHandler(&ocgrpc.ClientHandler{}), grpc.WithInsecure())
-		if err != nil {
-			return errors.WithMessage(err, "could not dial")
-		}
-
-		f(conn)
+	gatewayErr := make(chan error, 1)
+	if s.gateway != nil {
+		go func() {
+			if err := s.gateway.serve(); err != nil {
+				gatewayErr <- err
+				stop()
+			}
+		}()
 	}
 
-	return srv.Serve(lis)
+	err = srv.Serve(lis)
+	select {
+	case err := <-gatewayErr:
+		return errors.WithMessage(err, "gateway failed")
+	default:
+		return err
+	}
 }
 
 func (s *Server) Start() error {
@@ -103,6 +209,14 @@ func (s *Server) setUpMonitoring() error {
 		return errors.WithMessage(err, "registering grpc views failed")
 	}
 
+	if err := view.Register(ReloadCountView); err != nil {
+		return errors.WithMessage(err, "registering reload views failed")
+	}
+
+	if err := view.Register(RateLimitViews...); err != nil {
+		return errors.WithMessage(err, "registering rate limit views failed")
+	}
+
 	s.flusher = monitoring.CombineFlushFunc(flushers...)
 
 	return nil
@@ -0,0 +1,180 @@
+package grpcbase
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSConfig configures TLS of the gRPC server.
+type TLSConfig struct {
+	// CertFile and KeyFile are paths of the PEM encoded certificate and key of the server.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is an optional path of PEM encoded certificates of CAs. If set, clients
+	// must present a certificate signed by one of them (mutual TLS).
+	ClientCAFile string
+}
+
+// certificates holds the certificate of the server and the client CAs. They are
+// read again from disk on reload so certificates can be rotated without a restart.
+type certificates struct {
+	config TLSConfig
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func loadCertificates(config TLSConfig) (*certificates, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("both certificate and key are required for TLS")
+	}
+
+	c := &certificates{config: config}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload reads certificates from disk. Current certificates are kept if reading fails.
+func (c *certificates) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.config.CertFile, c.config.KeyFile)
+	if err != nil {
+		return errors.WithMessage(err, "loading certificate failed")
+	}
+
+	var clientCAs *x509.CertPool
+	if c.config.ClientCAFile != "" {
+		buf, err := ioutil.ReadFile(c.config.ClientCAFile)
+		if err != nil {
+			return errors.WithMessage(err, "reading client CAs failed")
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(buf) {
+			return errors.Errorf("no certificates found in '%s'", c.config.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *certificates) current() (*tls.Certificate, *x509.CertPool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, c.clientCAs
+}
+
+// serverConfig returns the TLS configuration of the server that always uses the
+// current certificates.
+func (c *certificates) serverConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := c.current()
+			return cert, nil
+		},
+	}
+	if c.config.ClientCAFile != "" {
+		// Client certificates are verified by verifyClient so the in-process
+		// connection of the gateway can authenticate with the server certificate.
+		config.ClientAuth = tls.RequireAnyClientCert
+		config.VerifyPeerCertificate = c.verifyClient
+	}
+	return config
+}
+
+// verifyClient accepts client certificates signed by one of the client CAs and the
+// certificate of the server itself, which is only held by the server.
+func (c *certificates) verifyClient(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	cert, clientCAs := c.current()
+	if len(rawCerts) == 0 {
+		return errors.New("client certificate is required")
+	}
+	if bytes.Equal(rawCerts[0], cert.Certificate[0]) {
+		return nil
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		parsed, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return errors.WithMessage(err, "invalid client certificate")
+		}
+		certs[i] = parsed
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return errors.WithMessage(err, "verifying client certificate failed")
+}
+
+// selfConfig returns the TLS configuration of connections of the server to itself.
+// The server is authenticated by its current certificate instead of its name because
+// it is dialed by its listen address.
+func (c *certificates) selfConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// The certificate is verified by VerifyPeerCertificate.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			cert, _ := c.current()
+			if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], cert.Certificate[0]) {
+				return errors.New("server presented an unexpected certificate")
+			}
+			return nil
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := c.current()
+			return cert, nil
+		},
+	}
+}
+
+// SetTLS serves all listeners of the server over TLS. Certificates are read again
+// when the server is reloaded.
+func (s *Server) SetTLS(config TLSConfig) error {
+	certs, err := loadCertificates(config)
+	if err != nil {
+		return err
+	}
+
+	s.certificates = certs
+	s.OnReload(certs.reload)
+	return nil
+}
+
+// serverOptions returns options of all gRPC servers.
+func (s *Server) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if s.certificates != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.certificates.serverConfig())))
+	}
+	return append(opts, s.interceptorOptions()...)
+}
+
+// selfDialOption returns the transport option for connections of the server to itself.
+func (s *Server) selfDialOption() grpc.DialOption {
+	if s.certificates != nil {
+		return grpc.WithTransportCredentials(credentials.NewTLS(s.certificates.selfConfig()))
+	}
+	return grpc.WithInsecure()
+}
@@ -0,0 +1,145 @@
+package grpcbase
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/arjantop/pwned-passwords/internal/grpctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// serveTLS serves the health service with the TLS configuration of s.
+func serveTLS(t *testing.T, s *Server) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer(s.serverOptions()...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+
+	return lis.Addr().String(), srv.Stop
+}
+
+// check calls the server over a new connection with the given transport option.
+func check(addr string, opts ...grpc.DialOption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, opts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func clientTLS(t *testing.T, caFile string, certFile string, keyFile string) grpc.DialOption {
+	buf, err := ioutil.ReadFile(caFile)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(buf))
+
+	config := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		require.NoError(t, err)
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(config))
+}
+
+func TestServerWithTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certs := grpctest.WriteCertificates(dir)
+	s := NewServer("", "test", "", nil)
+	require.NoError(t, s.SetTLS(TLSConfig{CertFile: certs.ServerCertFile, KeyFile: certs.ServerKeyFile}))
+
+	addr, stop := serveTLS(t, s)
+	defer stop()
+
+	assert.NoError(t, check(addr, clientTLS(t, certs.CAFile, "", "")))
+	assert.NoError(t, check(addr, s.selfDialOption()))
+	assert.Error(t, check(addr, grpc.WithInsecure()))
+}
+
+func TestServerWithMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	otherDir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(otherDir)
+
+	certs := grpctest.WriteCertificates(dir)
+	untrusted := grpctest.WriteCertificates(otherDir)
+
+	s := NewServer("", "test", "", nil)
+	require.NoError(t, s.SetTLS(TLSConfig{CertFile: certs.ServerCertFile, KeyFile: certs.ServerKeyFile, ClientCAFile: certs.CAFile}))
+
+	addr, stop := serveTLS(t, s)
+	defer stop()
+
+	assert.NoError(t, check(addr, clientTLS(t, certs.CAFile, certs.ClientCertFile, certs.ClientKeyFile)))
+	assert.NoError(t, check(addr, s.selfDialOption()), "the gateway authenticates with the server certificate")
+	assert.Error(t, check(addr, clientTLS(t, certs.CAFile, "", "")))
+	assert.Error(t, check(addr, clientTLS(t, certs.CAFile, untrusted.ClientCertFile, untrusted.ClientKeyFile)))
+}
+
+func TestServerReloadsCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certs := grpctest.WriteCertificates(dir)
+	s := NewServer("", "test", "", nil)
+	require.NoError(t, s.SetTLS(TLSConfig{CertFile: certs.ServerCertFile, KeyFile: certs.ServerKeyFile, ClientCAFile: certs.CAFile}))
+
+	addr, stop := serveTLS(t, s)
+	defer stop()
+
+	oldDir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(oldDir)
+	old := grpctest.Certificates{CAFile: path.Join(oldDir, "ca.pem"), ClientCertFile: path.Join(oldDir, "client.pem"), ClientKeyFile: path.Join(oldDir, "client-key.pem")}
+	require.NoError(t, os.Rename(certs.CAFile, old.CAFile))
+	require.NoError(t, os.Rename(certs.ClientCertFile, old.ClientCertFile))
+	require.NoError(t, os.Rename(certs.ClientKeyFile, old.ClientKeyFile))
+	grpctest.WriteCertificates(dir)
+
+	// New connections use the old certificates until the server is reloaded.
+	assert.NoError(t, check(addr, clientTLS(t, old.CAFile, old.ClientCertFile, old.ClientKeyFile)))
+	assert.Error(t, check(addr, clientTLS(t, certs.CAFile, certs.ClientCertFile, certs.ClientKeyFile)))
+
+	require.NoError(t, s.reload())
+	assert.NoError(t, check(addr, clientTLS(t, certs.CAFile, certs.ClientCertFile, certs.ClientKeyFile)))
+	assert.Error(t, check(addr, clientTLS(t, old.CAFile, old.ClientCertFile, old.ClientKeyFile)))
+	assert.NoError(t, check(addr, s.selfDialOption()))
+
+	// Certificates are kept if they can not be loaded.
+	require.NoError(t, ioutil.WriteFile(certs.ServerKeyFile, []byte("invalid"), 0600))
+	assert.Error(t, s.reload())
+	assert.NoError(t, check(addr, clientTLS(t, certs.CAFile, certs.ClientCertFile, certs.ClientKeyFile)))
+}
+
+func TestSetTLSFailsWithoutCertificate(t *testing.T) {
+	s := NewServer("", "test", "", nil)
+	assert.Error(t, s.SetTLS(TLSConfig{CertFile: "missing.pem"}))
+	assert.Error(t, s.SetTLS(TLSConfig{CertFile: "missing.pem", KeyFile: "missing-key.pem"}))
+}
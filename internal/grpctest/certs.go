@@ -0,0 +1,112 @@
+package grpctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path"
+	"time"
+)
+
+// Certificates are paths of PEM files written by WriteCertificates.
+type Certificates struct {
+	CAFile         string
+	ServerCertFile string
+	ServerKeyFile  string
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// WriteCertificates generates a new CA together with a server certificate for localhost
+// and a client certificate signed by it and writes them into dir. Existing files are
+// replaced.
+func WriteCertificates(dir string) Certificates {
+	certs := Certificates{
+		CAFile:         path.Join(dir, "ca.pem"),
+		ServerCertFile: path.Join(dir, "server.pem"),
+		ServerKeyFile:  path.Join(dir, "server-key.pem"),
+		ClientCertFile: path.Join(dir, "client.pem"),
+		ClientKeyFile:  path.Join(dir, "client-key.pem"),
+	}
+
+	caKey := generateKey()
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDer := createCertificate(ca, ca, caKey, caKey)
+	ca, err := x509.ParseCertificate(caDer)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse CA certificate: %v", err))
+	}
+	writePEM(certs.CAFile, "CERTIFICATE", caDer)
+
+	serverKey := generateKey()
+	writePEM(certs.ServerCertFile, "CERTIFICATE", createCertificate(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, serverKey, caKey))
+	writeKey(certs.ServerKeyFile, serverKey)
+
+	clientKey := generateKey()
+	writePEM(certs.ClientCertFile, "CERTIFICATE", createCertificate(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, clientKey, caKey))
+	writeKey(certs.ClientKeyFile, clientKey)
+
+	return certs
+}
+
+func generateKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate key: %v", err))
+	}
+	return key
+}
+
+func createCertificate(template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) []byte {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create certificate: %v", err))
+	}
+	return der
+}
+
+func writeKey(filePath string, key *ecdsa.PrivateKey) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(fmt.Sprintf("failed to marshal key: %v", err))
+	}
+	writePEM(filePath, "EC PRIVATE KEY", der)
+}
+
+func writePEM(filePath string, blockType string, der []byte) {
+	buf := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(filePath, buf, 0600); err != nil {
+		panic(fmt.Sprintf("failed to write %s: %v", filePath, err))
+	}
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/arjantop/pwned-passwords/internal/tracing"
+	"github.com/pkg/errors"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	cacheHits      = stats.Int64("pwnedpasswords/cache_hits", "Number of shards served from the cache", stats.UnitDimensionless)
+	cacheMisses    = stats.Int64("pwnedpasswords/cache_misses", "Number of shards not found in the cache", stats.UnitDimensionless)
+	cacheEvictions = stats.Int64("pwnedpasswords/cache_evictions", "Number of shards evicted from the cache", stats.UnitDimensionless)
+
+	CacheHitCountView = &view.View{
+		Name:        "pwnedpasswords/cache_hit_count",
+		Description: "Count of shards served from the cache",
+		Measure:     cacheHits,
+		Aggregation: view.Count(),
+	}
+	CacheMissCountView = &view.View{
+		Name:        "pwnedpasswords/cache_miss_count",
+		Description: "Count of shards not found in the cache",
+		Measure:     cacheMisses,
+		Aggregation: view.Count(),
+	}
+	CacheEvictionCountView = &view.View{
+		Name:        "pwnedpasswords/cache_eviction_count",
+		Description: "Count of shards evicted from the cache",
+		Measure:     cacheEvictions,
+		Aggregation: view.Sum(),
+	}
+
+	// CacheViews are all views of the cache statistics.
+	CacheViews = []*view.View{CacheHitCountView, CacheMissCountView, CacheEvictionCountView}
+)
+
+// hashOverhead is the memory used by a Hash besides the hash bytes.
+const hashOverhead = int64(unsafe.Sizeof(Hash{}))
+
+type cacheEntry struct {
+	key    string
+	hashes []Hash
+	size   int64
+}
+
+// CachedStorage is a Storage that keeps hashes of recently used keys in memory.
+//
+// The cache is bounded by the approximate number of bytes used by cached hashes and
+// evicts the least recently used keys first. Concurrent misses for the same key are
+// served by a single request to the underlying storage.
+//
+// Hashes returned by Get are shared between callers and must not be modified.
+type CachedStorage struct {
+	storage  Storage
+	maxBytes int64
+	group    singleflight.Group
+	// loading is the number of callers waiting for a load from the storage, accessed atomically.
+	loading int32
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// NewCachedStorage creates a cache of at most maxBytes in front of s.
+func NewCachedStorage(s Storage, maxBytes int64) *CachedStorage {
+	return &CachedStorage{
+		storage:  s,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (s *CachedStorage) Get(ctx context.Context, key string) (result []Hash, err error) {
+	ctx, span := trace.StartSpan(ctx, "CachedStorage.Get")
+	defer tracing.EndSpan(span, &err)
+
+	if hashes, ok := s.lookup(key); ok {
+		span.AddAttributes(trace.BoolAttribute("cache.hit", true))
+		stats.Record(ctx, cacheHits.M(1))
+		return hashes, nil
+	}
+	span.AddAttributes(trace.BoolAttribute("cache.hit", false))
+	stats.Record(ctx, cacheMisses.M(1))
+
+	for {
+		atomic.AddInt32(&s.loading, 1)
+		v, err, _ := s.group.Do(key, func() (interface{}, error) {
+			// A load that completed after the lookup above may have cached the hashes.
+			if hashes, ok := s.lookup(key); ok {
+				return hashes, nil
+			}
+			hashes, err := s.storage.Get(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			s.add(ctx, key, hashes)
+			return hashes, nil
+		})
+		atomic.AddInt32(&s.loading, -1)
+		// The shared request is made with the context of the first caller. If it was
+		// cancelled the request is retried for callers that are still waiting.
+		if err != nil && isContextError(err) && ctx.Err() == nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return v.([]Hash), nil
+	}
+}
+
+func isContextError(err error) bool {
+	cause := errors.Cause(err)
+	return cause == context.Canceled || cause == context.DeadlineExceeded
+}
+
+// GetShard is not cached, encoded shards are only requested for bulk downloads.
+func (s *CachedStorage) GetShard(ctx context.Context, key string) ([]byte, error) {
+	return s.storage.GetShard(ctx, key)
+}
+
+// Size returns the approximate number of bytes used by cached hashes.
+func (s *CachedStorage) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func (s *CachedStorage) lookup(key string) ([]Hash, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).hashes, true
+}
+
+func (s *CachedStorage) add(ctx context.Context, key string, hashes []Hash) {
+	size := int64(len(key))
+	for _, h := range hashes {
+		size += int64(len(h.Hash)) + hashOverhead
+	}
+	if size > s.maxBytes {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[key]; ok {
+		return
+	}
+
+	var evicted int64
+	for s.size+size > s.maxBytes {
+		oldest := s.lru.Back()
+		entry := oldest.Value.(*cacheEntry)
+		s.lru.Remove(oldest)
+		delete(s.entries, entry.key)
+		s.size -= entry.size
+		evicted++
+	}
+	if evicted > 0 {
+		stats.Record(ctx, cacheEvictions.M(evicted))
+	}
+
+	s.entries[key] = s.lru.PushFront(&cacheEntry{
+		key:    key,
+		hashes: hashes,
+		size:   size,
+	})
+	s.size += size
+}
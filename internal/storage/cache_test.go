@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedStorageServesRepeatedGetFromCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hashes := []Hash{{Hash: hashOf(1), Count: 1}}
+	mockStorage := NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "abcde").Return(hashes, nil).Times(1)
+
+	s := NewCachedStorage(mockStorage, 1024)
+	for i := 0; i < 3; i++ {
+		result, err := s.Get(context.Background(), "abcde")
+		assert.NoError(t, err)
+		assert.Equal(t, hashes, result)
+	}
+}
+
+func TestCachedStorageDoesNotCacheErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "abcde").Return(nil, errors.New("failed")).Times(2)
+
+	s := NewCachedStorage(mockStorage, 1024)
+	for i := 0; i < 2; i++ {
+		_, err := s.Get(context.Background(), "abcde")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int64(0), s.Size())
+}
+
+func TestCachedStorageEvictsLeastRecentlyUsedWhenFull(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hashes := []Hash{{Hash: hashOf(1), Count: 1}}
+	entrySize := int64(len("aaaaa")+len(hashes[0].Hash)) + hashOverhead
+
+	mockStorage := NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "aaaaa").Return(hashes, nil).Times(1)
+	mockStorage.EXPECT().Get(gomock.Any(), "bbbbb").Return(hashes, nil).Times(2)
+	mockStorage.EXPECT().Get(gomock.Any(), "ccccc").Return(hashes, nil).Times(1)
+
+	s := NewCachedStorage(mockStorage, 2*entrySize)
+	for _, key := range []string{"aaaaa", "bbbbb", "aaaaa", "ccccc", "aaaaa", "bbbbb"} {
+		_, err := s.Get(context.Background(), key)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2*entrySize, s.Size())
+}
+
+func TestCachedStorageDoesNotCacheEntriesLargerThanCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "abcde").Return([]Hash{{Hash: hashOf(1), Count: 1}}, nil).Times(2)
+
+	s := NewCachedStorage(mockStorage, 10)
+	for i := 0; i < 2; i++ {
+		_, err := s.Get(context.Background(), "abcde")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(0), s.Size())
+}
+
+type blockingStorage struct {
+	Storage
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *blockingStorage) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// waitForLoading waits until n callers are waiting for loads from the storage.
+func waitForLoading(t *testing.T, s *CachedStorage, n int32) {
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&s.loading) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d callers are loading, expected %d", atomic.LoadInt32(&s.loading), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *blockingStorage) Get(ctx context.Context, key string) ([]Hash, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+
+	<-s.release
+	return []Hash{{Hash: hashOf(1), Count: 1}}, nil
+}
+
+func TestCachedStorageDeduplicatesConcurrentMisses(t *testing.T) {
+	backing := &blockingStorage{release: make(chan struct{})}
+	s := NewCachedStorage(backing, 1024)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Get(context.Background(), "abcde")
+			assert.NoError(t, err)
+		}()
+	}
+
+	// All goroutines miss the cache before the first request completes.
+	waitForLoading(t, s, 10)
+	close(backing.release)
+	wg.Wait()
+
+	assert.Equal(t, 1, backing.callCount())
+}
+
+// cancelledLeaderStorage fails the first request when its context is cancelled.
+type cancelledLeaderStorage struct {
+	Storage
+	started chan struct{}
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *cancelledLeaderStorage) Get(ctx context.Context, key string) ([]Hash, error) {
+	s.mu.Lock()
+	s.calls++
+	first := s.calls == 1
+	s.mu.Unlock()
+
+	if first {
+		close(s.started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return []Hash{{Hash: hashOf(1), Count: 1}}, nil
+}
+
+func TestCachedStorageRetriesForWaitersIfFirstCallerIsCancelled(t *testing.T) {
+	backing := &cancelledLeaderStorage{started: make(chan struct{})}
+	s := NewCachedStorage(backing, 1024)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := s.Get(ctx, "abcde")
+		leader <- err
+	}()
+	<-backing.started
+
+	type result struct {
+		hashes []Hash
+		err    error
+	}
+	waiter := make(chan result, 1)
+	go func() {
+		hashes, err := s.Get(context.Background(), "abcde")
+		waiter <- result{hashes, err}
+	}()
+
+	// The waiter joins the request of the leader before it is cancelled.
+	waitForLoading(t, s, 2)
+	cancel()
+
+	assert.Equal(t, context.Canceled, <-leader)
+	r := <-waiter
+	assert.NoError(t, r.err)
+	assert.Equal(t, []Hash{{Hash: hashOf(1), Count: 1}}, r.hashes)
+}
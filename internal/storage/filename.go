@@ -2,6 +2,8 @@ package storage
 
 import (
 	"path"
+
+	"github.com/pkg/errors"
 )
 
 // splitEqualLength splits a string into strings of equal length.
@@ -31,3 +33,27 @@ func PathFor(s string, extension string) string {
 	parts := splitEqualLength(s, splitPartLength)
 	return path.Join(parts...) + extension
 }
+
+// IsValidKey reports whether the key is a non-empty lowercase hexadecimal string.
+//
+// Only valid keys are mapped to file paths so a key can never refer to a file
+// outside of the storage directory.
+func IsValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func checkKey(key string) error {
+	if !IsValidKey(key) {
+		return errors.Errorf("invalid key %q", key)
+	}
+	return nil
+}
@@ -2,7 +2,12 @@ package storage
 
 import (
 	"fmt"
+	"math/rand"
+	"path"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/quick"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,6 +34,36 @@ func TestPathForWithEmptyExtension(t *testing.T) {
 	assert.Equal(t, "aa", PathFor("aa", ""))
 }
 
+// pathKey is a random key made mostly of characters that are significant in paths.
+type pathKey string
+
+func (pathKey) Generate(rand *rand.Rand, size int) reflect.Value {
+	const alphabet = "0aF./\\%z\x00"
+	b := make([]byte, rand.Intn(12))
+	for i := range b {
+		b[i] = alphabet[rand.Intn(len(alphabet))]
+	}
+	return reflect.ValueOf(pathKey(b))
+}
+
+func TestIsValidKey(t *testing.T) {
+	assert.True(t, IsValidKey("0123456789abcdef"))
+	for _, key := range []string{"", "ABCDE", "zzzzz", "../..", "ab/cd", "abc.d", " abcd"} {
+		assert.False(t, IsValidKey(key), key)
+	}
+}
+
+func TestPathForValidKeysStaysInsideDir(t *testing.T) {
+	const dir = "/data/shards"
+	f := func(key pathKey) bool {
+		if !IsValidKey(string(key)) {
+			return true
+		}
+		return strings.HasPrefix(path.Join(dir, PathFor(string(key), ".bin")), dir+"/")
+	}
+	assert.NoError(t, quick.Check(f, &quick.Config{MaxCount: 10000}))
+}
+
 func ExamplePathFor() {
 	fmt.Println(PathFor("abcde", ".txt"))
 	// Output: abc/de.txt
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/arjantop/pwned-passwords/internal/tracing"
+	"go.opencensus.io/trace"
+)
+
+// Finder is implemented by storages that can look up a single hash without
+// returning all hashes for the key.
+type Finder interface {
+	// Find returns the hash with its count and whether it was found in the shard for the key.
+	Find(ctx context.Context, key string, hash []byte) (result Hash, found bool, err error)
+}
+
+// Find looks up a single hash in the shard for the key. Storages that do not
+// implement Finder are searched through the hashes returned by Get.
+func Find(ctx context.Context, s Storage, key string, hash []byte) (Hash, bool, error) {
+	if f, ok := s.(Finder); ok {
+		return f.Find(ctx, key, hash)
+	}
+
+	hashes, err := s.Get(ctx, key)
+	if err != nil {
+		return Hash{}, false, err
+	}
+	result, found := SearchHashes(hashes, hash)
+	return result, found, nil
+}
+
+// SearchHashes binary searches sorted hashes for the hash.
+func SearchHashes(hashes []Hash, hash []byte) (Hash, bool) {
+	i := sort.Search(len(hashes), func(i int) bool {
+		return bytes.Compare(hashes[i].Hash, hash) >= 0
+	})
+	if i < len(hashes) && bytes.Equal(hashes[i].Hash, hash) {
+		return hashes[i], true
+	}
+	return Hash{}, false
+}
+
+// Find binary searches the validated shard for the key.
+func (s *ObjectStorage) Find(ctx context.Context, key string, hash []byte) (result Hash, found bool, err error) {
+	ctx, span := trace.StartSpan(ctx, "ObjectStorage.Find")
+	defer tracing.EndSpan(span, &err)
+
+	_, hashes, err := s.readShard(ctx, key)
+	if IsNotFound(err) {
+		return Hash{}, false, nil
+	}
+	if err != nil {
+		return Hash{}, false, err
+	}
+
+	result, found = SearchHashes(hashes, hash)
+	return result, found, nil
+}
+
+func (s *GenerationalStorage) Find(ctx context.Context, key string, hash []byte) (Hash, bool, error) {
+	return Find(ctx, s.generationFor(ctx).storage, key, hash)
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchHashes(t *testing.T) {
+	hashes := []Hash{
+		{Hash: hashOf(1), Count: 1},
+		{Hash: hashOf(3), Count: 3},
+		{Hash: hashOf(5), Count: 5},
+	}
+
+	for _, h := range hashes {
+		result, found := SearchHashes(hashes, h.Hash)
+		assert.True(t, found)
+		assert.Equal(t, h, result)
+	}
+	for _, b := range []byte{0, 2, 4, 6} {
+		_, found := SearchHashes(hashes, hashOf(b))
+		assert.False(t, found, "hash of %d", b)
+	}
+}
+
+func TestObjectStorageFind(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	buf, err := EncodeShardWith(ShardEncodingCompact, HashTypeSHA1, []Hash{
+		{Hash: hashOf(1), Count: 10},
+		{Hash: hashOf(2), Count: 20},
+	})
+	require.NoError(t, err)
+
+	backend := NewMockBackend(ctrl)
+	backend.EXPECT().Read(gomock.Any(), "abcde").DoAndReturn(func(ctx context.Context, key string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf)), nil
+	}).Times(2)
+	backend.EXPECT().Read(gomock.Any(), "bcdef").Return(nil, ErrNotFound)
+
+	var s Storage = &ObjectStorage{Backend: backend}
+
+	result, found, err := Find(context.Background(), s, "abcde", hashOf(2))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint32(20), result.Count)
+
+	_, found, err = Find(context.Background(), s, "abcde", hashOf(3))
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, found, err = Find(context.Background(), s, "bcdef", hashOf(3))
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CurrentGenerationFile is the name of the file in a data directory that contains
+// the name of the generation being served.
+const CurrentGenerationFile = "CURRENT"
+
+// CurrentGeneration returns the name of the current generation in dir. An empty
+// name is returned if dir does not contain generations.
+func CurrentGeneration(dir string) (string, error) {
+	buf, err := ioutil.ReadFile(path.Join(dir, CurrentGenerationFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.WithMessage(err, "reading current generation failed")
+	}
+
+	name := strings.TrimSpace(string(buf))
+	if err := validateGenerationName(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// SetCurrentGeneration atomically switches the current generation in dir.
+func SetCurrentGeneration(dir string, name string) error {
+	if err := validateGenerationName(name); err != nil {
+		return err
+	}
+	if _, err := os.Stat(path.Join(dir, name)); err != nil {
+		return errors.WithMessagef(err, "generation '%s' does not exist", name)
+	}
+
+	tmpPath := path.Join(dir, CurrentGenerationFile+".tmp")
+	if err := ioutil.WriteFile(tmpPath, []byte(name+"\n"), 0644); err != nil {
+		return errors.WithMessage(err, "writing current generation failed")
+	}
+
+	return errors.WithMessage(os.Rename(tmpPath, path.Join(dir, CurrentGenerationFile)), "replacing current generation failed")
+}
+
+func validateGenerationName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return errors.Errorf("invalid generation name '%s'", name)
+	}
+	return nil
+}
+
+// Pinner is implemented by storages whose data can change while serving.
+type Pinner interface {
+	// Pin returns a context that makes all requests with it see the data as it was
+	// at the time of the call.
+	Pin(ctx context.Context) context.Context
+}
+
+// Pin pins the current data of s to the context if s supports it.
+func Pin(ctx context.Context, s Storage) context.Context {
+	if p, ok := s.(Pinner); ok {
+		return p.Pin(ctx)
+	}
+	return ctx
+}
+
+type generation struct {
+	name    string
+	storage Storage
+}
+
+type pinnedGenerationKey struct {
+	storage *GenerationalStorage
+}
+
+// GenerationalStorage serves data from the current generation of a data directory.
+//
+// A data directory with generations contains a directory for every generation and
+// a CurrentGenerationFile with the name of the one being served. A directory
+// without a CurrentGenerationFile is served as a single generation.
+//
+// Storage created with NewReopenableStorage serves a single unnamed generation that
+// is opened again on Reopen.
+type GenerationalStorage struct {
+	// resolve returns the name and the directory of the current generation.
+	resolve func() (string, string, error)
+	open    func(dir string) (Storage, error)
+
+	// loadMu serializes loads so a load that read an older current generation can not
+	// replace a newer one.
+	loadMu sync.Mutex
+
+	mu      sync.RWMutex
+	current *generation
+}
+
+// NewGenerationalStorage creates a storage for the current generation in dir.
+// Storage for a generation directory is created with open, which should verify that
+// the generation can be served. A generation is only switched to if open succeeds.
+func NewGenerationalStorage(dir string, open func(dir string) (Storage, error)) (*GenerationalStorage, error) {
+	s := &GenerationalStorage{
+		resolve: func() (string, string, error) {
+			return currentGenerationDir(dir)
+		},
+		open: open,
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewReopenableStorage creates a storage opened with open that can be replaced with
+// Reopen, for datasets that are not stored in a local data directory.
+func NewReopenableStorage(open func() (Storage, error)) (*GenerationalStorage, error) {
+	s := &GenerationalStorage{
+		resolve: func() (string, string, error) {
+			return "", "", nil
+		},
+		open: func(string) (Storage, error) {
+			return open()
+		},
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload switches to the current generation if it has changed since the last reload.
+// Requests pinned to the previous generation keep being served from it.
+func (s *GenerationalStorage) Reload() error {
+	return s.load(false)
+}
+
+// Reopen opens the current generation again even if it has not changed. Any state
+// held by the storage of the previous generation is discarded. The previous generation
+// keeps being served if opening fails.
+func (s *GenerationalStorage) Reopen() error {
+	return s.load(true)
+}
+
+func (s *GenerationalStorage) load(force bool) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	name, dir, err := s.resolve()
+	if err != nil {
+		return err
+	}
+
+	if current := s.generation(); !force && current != nil && current.name == name {
+		return nil
+	}
+
+	st, err := s.open(dir)
+	if err != nil {
+		return errors.WithMessagef(err, "opening generation '%s' failed", name)
+	}
+
+	s.mu.Lock()
+	s.current = &generation{
+		name:    name,
+		storage: st,
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// currentGenerationDir returns the name and the directory of the current generation in dir.
+func currentGenerationDir(dir string) (string, string, error) {
+	name, err := CurrentGeneration(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	if name != "" {
+		dir = path.Join(dir, name)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", "", errors.WithMessagef(err, "generation '%s' is not available", name)
+	}
+	if !info.IsDir() {
+		return "", "", errors.Errorf("generation '%s' is not a directory", name)
+	}
+	return name, dir, nil
+}
+
+// Generation returns the name of the generation being served.
+func (s *GenerationalStorage) Generation() string {
+	return s.generation().name
+}
+
+func (s *GenerationalStorage) generation() *generation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+func (s *GenerationalStorage) generationFor(ctx context.Context) *generation {
+	if g, ok := ctx.Value(pinnedGenerationKey{s}).(*generation); ok {
+		return g
+	}
+	return s.generation()
+}
+
+// Pin pins the current generation to the context. A context that is already
+// pinned keeps its generation.
+func (s *GenerationalStorage) Pin(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(pinnedGenerationKey{s}).(*generation); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, pinnedGenerationKey{s}, s.generation())
+}
+
+func (s *GenerationalStorage) Get(ctx context.Context, key string) ([]Hash, error) {
+	return s.generationFor(ctx).storage.Get(ctx, key)
+}
+
+func (s *GenerationalStorage) GetShard(ctx context.Context, key string) ([]byte, error) {
+	return s.generationFor(ctx).storage.GetShard(ctx, key)
+}
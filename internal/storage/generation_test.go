@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeGeneration(t *testing.T, dir string, name string, hashes []Hash) {
+	buf, err := EncodeShard(HashTypeSHA1, hashes)
+	require.NoError(t, err)
+	require.NoError(t, WriteShardFile(path.Join(dir, name), "abcde", buf))
+}
+
+func openLocal(dir string) (Storage, error) {
+	return NewLocalStorage(dir, HashTypeSHA1), nil
+}
+
+func TestGenerationalStorageServesDirWithoutGenerations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hashes := []Hash{{Hash: hashOf(1), Count: 1}}
+	writeGeneration(t, dir, "", hashes)
+
+	s, err := NewGenerationalStorage(dir, openLocal)
+	require.NoError(t, err)
+	assert.Equal(t, "", s.Generation())
+
+	result, err := s.Get(context.Background(), "abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, hashes, result)
+}
+
+func TestGenerationalStorageSwitchesGenerationOnReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	oldHashes := []Hash{{Hash: hashOf(1), Count: 1}}
+	newHashes := []Hash{{Hash: hashOf(1), Count: 2}}
+	writeGeneration(t, dir, "v1", oldHashes)
+	writeGeneration(t, dir, "v2", newHashes)
+	require.NoError(t, SetCurrentGeneration(dir, "v1"))
+
+	s, err := NewGenerationalStorage(dir, openLocal)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", s.Generation())
+
+	pinned := Pin(context.Background(), s)
+
+	require.NoError(t, SetCurrentGeneration(dir, "v2"))
+	require.NoError(t, s.Reload())
+	assert.Equal(t, "v2", s.Generation())
+
+	result, err := s.Get(context.Background(), "abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, newHashes, result)
+
+	result, err = s.Get(pinned, "abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, oldHashes, result)
+}
+
+func TestGenerationalStorageKeepsGenerationIfReloadFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeGeneration(t, dir, "v1", []Hash{{Hash: hashOf(1), Count: 1}})
+	require.NoError(t, SetCurrentGeneration(dir, "v1"))
+
+	s, err := NewGenerationalStorage(dir, openLocal)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, CurrentGenerationFile), []byte("missing"), 0644))
+	assert.Error(t, s.Reload())
+	assert.Equal(t, "v1", s.Generation())
+}
+
+func TestSetCurrentGenerationFailsForInvalidGeneration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Error(t, SetCurrentGeneration(dir, "missing"))
+	assert.Error(t, SetCurrentGeneration(dir, "../other"))
+}
+
+func TestGenerationalStorageReopenOpensSameGenerationAgain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeGeneration(t, dir, "v1", []Hash{{Hash: hashOf(1), Count: 1}})
+	require.NoError(t, SetCurrentGeneration(dir, "v1"))
+
+	var opened int
+	s, err := NewGenerationalStorage(dir, func(dir string) (Storage, error) {
+		opened++
+		return openLocal(dir)
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, s.Reload())
+	assert.Equal(t, 1, opened)
+
+	assert.NoError(t, s.Reopen())
+	assert.Equal(t, 2, opened)
+	assert.Equal(t, "v1", s.Generation())
+}
+
+func TestGenerationalStorageSerializesLoads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeGeneration(t, dir, "v1", []Hash{{Hash: hashOf(1), Count: 1}})
+	writeGeneration(t, dir, "v2", []Hash{{Hash: hashOf(1), Count: 2}})
+	require.NoError(t, SetCurrentGeneration(dir, "v1"))
+
+	opening, release := make(chan struct{}), make(chan struct{})
+	s, err := NewGenerationalStorage(dir, openLocal)
+	require.NoError(t, err)
+	s.open = func(genDir string) (Storage, error) {
+		if path.Base(genDir) == "v1" {
+			close(opening)
+			<-release
+		}
+		return openLocal(genDir)
+	}
+
+	reopened := make(chan error, 1)
+	go func() {
+		reopened <- s.Reopen()
+	}()
+	<-opening
+
+	// The generation changes while the old one is being reopened.
+	require.NoError(t, SetCurrentGeneration(dir, "v2"))
+	reloaded := make(chan error, 1)
+	go func() {
+		reloaded <- s.Reload()
+	}()
+	select {
+	case err := <-reloaded:
+		t.Fatalf("reload finished during reopen: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assert.NoError(t, <-reopened)
+	assert.NoError(t, <-reloaded)
+	assert.Equal(t, "v2", s.Generation())
+}
+
+func TestReopenableStorageReplacesStorageOnReopen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	first := []Hash{{Hash: hashOf(1), Count: 1}}
+	second := []Hash{{Hash: hashOf(1), Count: 2}}
+	storages := []*MockStorage{NewMockStorage(ctrl), NewMockStorage(ctrl)}
+	storages[0].EXPECT().Get(gomock.Any(), "abcde").Return(first, nil)
+	storages[1].EXPECT().Get(gomock.Any(), "abcde").Return(second, nil)
+
+	var opened int
+	s, err := NewReopenableStorage(func() (Storage, error) {
+		opened++
+		return storages[opened-1], nil
+	})
+	require.NoError(t, err)
+	pinned := Pin(context.Background(), s)
+
+	assert.NoError(t, s.Reload())
+	assert.Equal(t, 1, opened, "reload keeps the storage")
+
+	assert.NoError(t, s.Reopen())
+	assert.Equal(t, 2, opened)
+	assert.Equal(t, "", s.Generation())
+
+	result, err := s.Get(context.Background(), "abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, second, result)
+
+	result, err = s.Get(pinned, "abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, first, result)
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+)
+
+// HashType identifies the hash algorithm of the stored records.
+type HashType uint8
+
+const (
+	HashTypeSHA1 HashType = 1
+	HashTypeNTLM HashType = 2
+)
+
+// ParseHashType parses the name of a hash type as returned by HashType.String.
+func ParseHashType(s string) (HashType, error) {
+	switch strings.ToLower(s) {
+	case "sha1":
+		return HashTypeSHA1, nil
+	case "ntlm":
+		return HashTypeNTLM, nil
+	default:
+		return 0, fmt.Errorf("unknown hash type '%s'", s)
+	}
+}
+
+func (t HashType) String() string {
+	switch t {
+	case HashTypeSHA1:
+		return "sha1"
+	case HashTypeNTLM:
+		return "ntlm"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// Valid reports whether t is a known hash type.
+func (t HashType) Valid() bool {
+	return t == HashTypeSHA1 || t == HashTypeNTLM
+}
+
+// Size returns the size of a hash in bytes.
+func (t HashType) Size() int {
+	switch t {
+	case HashTypeSHA1:
+		return sha1.Size
+	case HashTypeNTLM:
+		// NTLM hashes are MD4 digests.
+		return 16
+	default:
+		return 0
+	}
+}
+
+// RecordSize returns the size of a single encoded record (hash followed by its count).
+func (t HashType) RecordSize() int {
+	return t.Size() + countSize
+}
+
+func (t HashType) MarshalText() ([]byte, error) {
+	if !t.Valid() {
+		return nil, fmt.Errorf("unknown hash type %s", t)
+	}
+	return []byte(t.String()), nil
+}
+
+func (t *HashType) UnmarshalText(text []byte) error {
+	parsed, err := ParseHashType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHashType(t *testing.T) {
+	for _, hashType := range []HashType{HashTypeSHA1, HashTypeNTLM} {
+		parsed, err := ParseHashType(hashType.String())
+		assert.NoError(t, err)
+		assert.Equal(t, hashType, parsed)
+	}
+
+	_, err := ParseHashType("md5")
+	assert.Error(t, err)
+}
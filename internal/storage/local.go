@@ -7,38 +7,99 @@ import (
 	"os"
 	"path"
 
+	"github.com/arjantop/pwned-passwords/internal/tracing"
+	"github.com/pkg/errors"
 	"go.opencensus.io/trace"
 )
 
-func NewLocalStorage(dir string) Storage {
+func NewLocalStorage(dir string, hashType HashType) Storage {
 	return &ObjectStorage{
-		Backend: &LocalBackend{Dir: dir},
+		Backend:  &LocalBackend{Dir: dir},
+		HashType: hashType,
 	}
 }
 
-type errReader struct {
-	err error
-}
-
-func (r *errReader) Read(p []byte) (int, error) {
-	return 0, r.err
-}
-
 // LocalBackend is a storage backend that reads files from the local filesystem.
 type LocalBackend struct {
 	Dir string
 }
 
-func (s *LocalBackend) Read(ctx context.Context, key string) io.ReadCloser {
+func (s *LocalBackend) Read(ctx context.Context, key string) (r io.ReadCloser, err error) {
 	ctx, span := trace.StartSpan(ctx, "LocalBackend.Read")
-	defer span.End()
+	defer tracing.EndSpan(span, &err)
 
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
 	filePath := PathFor(key, ".bin")
 
 	f, err := os.Open(path.Join(s.Dir, filePath))
+	if os.IsNotExist(err) {
+		return nil, errors.WithMessagef(ErrNotFound, "file '%s'", filePath)
+	}
+	if err != nil {
+		return nil, wrapTemporary(err)
+	}
+
+	return f, nil
+}
+
+// Write stores the shard for the key so LocalBackend can be used as a cache tier of a TieredBackend.
+func (s *LocalBackend) Write(ctx context.Context, key string, data []byte) error {
+	return WriteShardFile(s.Dir, key, data)
+}
+
+// WriteShardFile writes the encoded shard for the key into dir using the same layout
+// that LocalBackend reads from.
+//
+// The shard is first written to a temporary file and then renamed so readers never
+// observe a partially written shard.
+func WriteShardFile(dir string, key string, shard []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	fullPath := path.Join(dir, PathFor(key, ".bin"))
+	if err := os.MkdirAll(path.Dir(fullPath), 0755); err != nil {
+		return errors.WithMessage(err, "creating directory failed")
+	}
+
+	f, err := ioutil.TempFile(path.Dir(fullPath), ".tmp-"+path.Base(fullPath))
 	if err != nil {
-		return ioutil.NopCloser(&errReader{err})
+		return errors.WithMessage(err, "creating file failed")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(shard); err != nil {
+		f.Close()
+		return errors.WithMessage(err, "writing shard failed")
+	}
+	if err := f.Close(); err != nil {
+		return errors.WithMessage(err, "closing file failed")
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return errors.WithMessage(err, "changing file mode failed")
+	}
+
+	return errors.WithMessage(os.Rename(f.Name(), fullPath), "renaming file failed")
+}
+
+// LinkShardFile makes the shard for the key in fromDir available in toDir without
+// copying it by creating a hard link.
+func LinkShardFile(fromDir string, toDir string, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	filePath := PathFor(key, ".bin")
+	fullPath := path.Join(toDir, filePath)
+	if err := os.MkdirAll(path.Dir(fullPath), 0755); err != nil {
+		return errors.WithMessage(err, "creating directory failed")
+	}
+
+	tmpPath := path.Join(path.Dir(fullPath), ".tmp-link-"+path.Base(fullPath))
+	os.Remove(tmpPath)
+	if err := os.Link(path.Join(fromDir, filePath), tmpPath); err != nil {
+		return errors.WithMessage(err, "linking shard failed")
 	}
 
-	return f
+	return errors.WithMessage(os.Rename(tmpPath, fullPath), "renaming file failed")
 }
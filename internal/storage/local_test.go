@@ -1 +1,122 @@
 package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStorageGetReadsShardFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	hashes := []Hash{{Hash: hashOf(1), Count: 3}}
+	buf, err := EncodeShard(HashTypeSHA1, hashes)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(path.Join(dir, "abc"), 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "abc", "de.bin"), buf, 0644))
+
+	s := NewLocalStorage(dir, HashTypeSHA1)
+
+	result, err := s.Get(context.Background(), "abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, hashes, result)
+}
+
+func TestLocalStorageGetReturnsEmptyResultForMissingShard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewLocalStorage(dir, HashTypeSHA1)
+
+	result, err := s.Get(context.Background(), "abcde")
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+
+	_, err = s.GetShard(context.Background(), "abcde")
+	assert.True(t, IsNotFound(err))
+}
+
+func TestLocalBackendReadFailsForUnreadableShard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// A directory in place of the shard file can not be read.
+	assert.NoError(t, os.MkdirAll(path.Join(dir, "abc", "de.bin"), 0755))
+
+	_, err = NewLocalStorage(dir, HashTypeSHA1).Get(context.Background(), "abcde")
+	if assert.Error(t, err) {
+		assert.False(t, IsNotFound(err))
+	}
+}
+
+func TestWriteShardFileIsReadableByLocalStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	hashes := []Hash{{Hash: hashOf(2), Count: 5}}
+	buf, err := EncodeShard(HashTypeSHA1, hashes)
+	assert.NoError(t, err)
+	assert.NoError(t, WriteShardFile(dir, "abcde", buf))
+
+	files, err := ioutil.ReadDir(path.Join(dir, "abc"))
+	if assert.NoError(t, err) && assert.Len(t, files, 1) {
+		assert.Equal(t, "de.bin", files[0].Name())
+	}
+
+	result, err := NewLocalStorage(dir, HashTypeSHA1).Get(context.Background(), "abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, hashes, result)
+}
+
+func TestLocalBackendNeverAccessesFilesOutsideDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "local-storage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(root)
+
+	dir := path.Join(root, "data")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	// A shard outside of Dir that keys escaping Dir could reach.
+	assert.NoError(t, WriteShardFile(root, "abc", []byte("outside")))
+
+	b := &LocalBackend{Dir: dir}
+	f := func(key pathKey) bool {
+		writeErr := b.Write(context.Background(), string(key), []byte("shard"))
+		r, readErr := b.Read(context.Background(), string(key))
+		if r != nil {
+			r.Close()
+		}
+		if IsValidKey(string(key)) {
+			return writeErr == nil && readErr == nil
+		}
+		return writeErr != nil && readErr != nil && !IsNotFound(readErr)
+	}
+	assert.NoError(t, quick.Check(f, &quick.Config{MaxCount: 2000}))
+
+	files, err := ioutil.ReadDir(root)
+	assert.NoError(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"abc.bin", "data"}, names)
+}
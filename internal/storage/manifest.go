@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestFileName is the name of the file describing the dataset in a data directory.
+const ManifestFileName = "manifest.json"
+
+const (
+	// DefaultPrefixLength is the prefix length of datasets without a manifest.
+	DefaultPrefixLength = 5
+	// MaxPrefixLength is the longest supported prefix length in hex characters.
+	MaxPrefixLength = 8
+)
+
+// ReleaseDateLayout is the layout of Manifest.ReleaseDate.
+const ReleaseDateLayout = "2006-01-02"
+
+// Manifest describes a dataset. It is written by preprocess next to the shards.
+type Manifest struct {
+	HashType HashType `json:"hashType"`
+	// PrefixLength is the number of leading hex characters of hashes used as shard keys.
+	PrefixLength int           `json:"prefixLength"`
+	Encoding     ShardEncoding `json:"encoding"`
+
+	// Version is the version of the source corpus, for example "v5".
+	Version string `json:"version,omitempty"`
+	// ReleaseDate is the date the source corpus was released in ReleaseDateLayout.
+	ReleaseDate string `json:"releaseDate,omitempty"`
+	// HashCount is the number of distinct hashes in the dataset.
+	HashCount uint64 `json:"hashCount"`
+	// BuildTime is the time preprocessing of the dataset finished.
+	BuildTime time.Time `json:"buildTime"`
+	// Checksum is the hex encoded SHA-256 of all hashes and their counts in hash order.
+	// It only depends on the contents of the dataset and not on how it is stored.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// DefaultManifest returns the manifest assumed for datasets written without one.
+// The hash type and encoding are unknown.
+func DefaultManifest() Manifest {
+	return Manifest{PrefixLength: DefaultPrefixLength}
+}
+
+// Validate checks that the manifest describes a supported dataset.
+func (m Manifest) Validate() error {
+	if m.HashType != 0 && !m.HashType.Valid() {
+		return errors.Errorf("unknown hash type %s", m.HashType)
+	}
+	if m.PrefixLength < 1 || m.PrefixLength > MaxPrefixLength {
+		return errors.Errorf("prefix length %d is not between 1 and %d", m.PrefixLength, MaxPrefixLength)
+	}
+	if m.ReleaseDate != "" {
+		if _, err := time.Parse(ReleaseDateLayout, m.ReleaseDate); err != nil {
+			return errors.Errorf("release date '%s' is not in the YYYY-MM-DD format", m.ReleaseDate)
+		}
+	}
+	return nil
+}
+
+// HashPrefix returns the shard key of the hash.
+func (m Manifest) HashPrefix(hash []byte) string {
+	return HashPrefix(hash, m.PrefixLength)
+}
+
+// HashPrefix returns the first length hex characters of the hash.
+func HashPrefix(hash []byte, length int) string {
+	return hex.EncodeToString(hash[:(length+1)/2])[:length]
+}
+
+// WriteManifest atomically writes the manifest into dir.
+func WriteManifest(dir string, m Manifest) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.WithMessage(err, "encoding manifest failed")
+	}
+
+	tmpPath := path.Join(dir, ManifestFileName+".tmp")
+	if err := ioutil.WriteFile(tmpPath, append(buf, '\n'), 0644); err != nil {
+		return errors.WithMessage(err, "writing manifest failed")
+	}
+
+	return errors.WithMessage(os.Rename(tmpPath, path.Join(dir, ManifestFileName)), "replacing manifest failed")
+}
+
+// ReadManifest reads the manifest of the dataset in dir. The DefaultManifest is
+// returned for datasets without one.
+func ReadManifest(dir string) (Manifest, error) {
+	f, err := os.Open(path.Join(dir, ManifestFileName))
+	if os.IsNotExist(err) {
+		return DefaultManifest(), nil
+	}
+	if err != nil {
+		return Manifest{}, errors.WithMessage(err, "opening manifest failed")
+	}
+	defer f.Close()
+
+	return DecodeManifest(f)
+}
+
+// DecodeManifest decodes and validates a manifest.
+func DecodeManifest(r io.Reader) (Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return Manifest{}, errors.WithMessage(err, "decoding manifest failed")
+	}
+	if err := m.Validate(); err != nil {
+		return Manifest{}, errors.WithMessage(err, "invalid manifest")
+	}
+	return m, nil
+}
+
+// ManifestProvider is implemented by storages that know the manifest of the dataset they serve.
+type ManifestProvider interface {
+	// Manifest returns the manifest of the dataset served to requests with the context.
+	Manifest(ctx context.Context) Manifest
+}
+
+// ManifestOf returns the manifest of the dataset served by s or the DefaultManifest
+// if s does not provide one.
+func ManifestOf(ctx context.Context, s Storage) Manifest {
+	if p, ok := s.(ManifestProvider); ok {
+		return p.Manifest(ctx)
+	}
+	return DefaultManifest()
+}
+
+// WithManifest returns a storage that provides the manifest of the dataset served by s.
+func WithManifest(s Storage, m Manifest) Storage {
+	return &manifestStorage{Storage: s, manifest: m}
+}
+
+type manifestStorage struct {
+	Storage
+	manifest Manifest
+}
+
+func (s *manifestStorage) Manifest(ctx context.Context) Manifest {
+	return s.manifest
+}
+
+func (s *manifestStorage) Find(ctx context.Context, key string, hash []byte) (Hash, bool, error) {
+	return Find(ctx, s.Storage, key, hash)
+}
+
+func (s *GenerationalStorage) Manifest(ctx context.Context) Manifest {
+	return ManifestOf(ctx, s.generationFor(ctx).storage)
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteManifestAndReadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := ReadManifest(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultManifest(), m)
+
+	written := Manifest{
+		HashType:     HashTypeNTLM,
+		PrefixLength: 4,
+		Encoding:     ShardEncodingCompact,
+		Version:      "v5",
+		ReleaseDate:  "2019-07-18",
+		HashCount:    555278657,
+		BuildTime:    time.Date(2019, 7, 20, 10, 30, 0, 0, time.UTC),
+		Checksum:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}
+	require.NoError(t, WriteManifest(dir, written))
+
+	buf, err := ioutil.ReadFile(path.Join(dir, ManifestFileName))
+	require.NoError(t, err)
+	assert.Contains(t, string(buf), `"hashType": "ntlm"`)
+
+	m, err = ReadManifest(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, written, m)
+}
+
+func TestDecodeManifestFailsForInvalidManifest(t *testing.T) {
+	for _, manifest := range []string{
+		`{"hashType": "md5", "prefixLength": 5, "encoding": "raw"}`,
+		`{"hashType": "sha1", "prefixLength": 0, "encoding": "raw"}`,
+		`{"hashType": "sha1", "prefixLength": 9, "encoding": "raw"}`,
+		`{"hashType": "sha1", "prefixLength": 5, "encoding": "gzip"}`,
+		`{"hashType": "sha1", "prefixLength": 5, "encoding": "raw", "releaseDate": "18.7.2019"}`,
+		`not json`,
+	} {
+		_, err := DecodeManifest(strings.NewReader(manifest))
+		assert.Error(t, err, manifest)
+	}
+}
+
+func TestHashPrefix(t *testing.T) {
+	hash := []byte{0xab, 0xcd, 0xef, 0x12}
+	assert.Equal(t, "a", HashPrefix(hash, 1))
+	assert.Equal(t, "abcd", HashPrefix(hash, 4))
+	assert.Equal(t, "abcde", HashPrefix(hash, 5))
+	assert.Equal(t, "abcdef1", Manifest{PrefixLength: 7}.HashPrefix(hash))
+}
+
+func TestGenerationalStorageProvidesManifestOfGeneration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, g := range []struct {
+		name         string
+		prefixLength int
+	}{{"v1", 5}, {"v2", 4}} {
+		require.NoError(t, os.Mkdir(path.Join(dir, g.name), 0755))
+		require.NoError(t, WriteManifest(path.Join(dir, g.name), Manifest{HashType: HashTypeSHA1, PrefixLength: g.prefixLength, Encoding: ShardEncodingRaw}))
+	}
+	require.NoError(t, SetCurrentGeneration(dir, "v1"))
+
+	s, err := NewGenerationalStorage(dir, func(dir string) (Storage, error) {
+		m, err := ReadManifest(dir)
+		if err != nil {
+			return nil, err
+		}
+		return WithManifest(NewLocalStorage(dir, m.HashType), m), nil
+	})
+	require.NoError(t, err)
+
+	pinned := Pin(context.Background(), s)
+	require.NoError(t, SetCurrentGeneration(dir, "v2"))
+	require.NoError(t, s.Reload())
+
+	assert.Equal(t, 5, ManifestOf(pinned, s).PrefixLength)
+	assert.Equal(t, 4, ManifestOf(context.Background(), s).PrefixLength)
+}
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/arjantop/pwned-passwords/internal/tracing"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+)
+
+// PackedFileName is the name of the packed file in a data directory. A data
+// directory contains either a packed file or a tree of shard files.
+const PackedFileName = "hashes.pack"
+
+// A packed file stores the shards of all prefixes in a single file. It starts
+// with a fixed size header followed by an index and the shards. All integers
+// are big-endian:
+//
+//	magic        [4]byte  "PWPK"
+//	version      uint8    format version
+//	prefixLength uint8    length of shard keys in hex characters
+//	reserved     [2]byte
+//	index        [16^prefixLength+1]uint64
+//
+// The shard for prefix n spans the bytes from index[n] to index[n+1] of the file.
+// A prefix without a shard has an empty span.
+const (
+	PackedFormatVersion = 1
+	packedHeaderSize    = 8
+	// maxPackedPrefixLength keeps the index of a packed file within a reasonable size.
+	maxPackedPrefixLength = 7
+)
+
+var packedMagic = [4]byte{'P', 'W', 'P', 'K'}
+
+func packedIndexSize(prefixLength int) int {
+	return 8 * ((1 << (4 * uint(prefixLength))) + 1)
+}
+
+// parsePackedKey returns the position of the key in the index of a packed file.
+func parsePackedKey(key string, prefixLength int) (int, error) {
+	if len(key) != prefixLength {
+		return 0, errors.Errorf("key '%s' must be %d characters long", key, prefixLength)
+	}
+	n, err := strconv.ParseUint(key, 16, 32)
+	if err != nil {
+		return 0, errors.Errorf("key '%s' must be hexadecimal", key)
+	}
+	return int(n), nil
+}
+
+// PackedBackend is a storage backend that reads shards from a memory-mapped packed file.
+type PackedBackend struct {
+	data         []byte
+	index        []byte
+	prefixLength int
+	unmap        func() error
+	closeOnce    sync.Once
+	closeErr     error
+}
+
+// OpenPackedBackend maps the packed file into memory and validates its index.
+//
+// An error satisfying IsCorrupted is returned if the file is not a valid packed file.
+func OpenPackedBackend(filePath string) (*PackedBackend, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "opening packed file failed")
+	}
+	defer f.Close()
+
+	data, unmap, err := mmapFile(f)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "mapping packed file '%s' failed", filePath)
+	}
+
+	b, err := newPackedBackend(data, unmap)
+	if err != nil {
+		unmap()
+		return nil, errors.WithMessagef(err, "opening packed file '%s' failed", filePath)
+	}
+	// Backends of replaced generations are not closed explicitly because pinned
+	// requests may still be reading from them.
+	runtime.SetFinalizer(b, (*PackedBackend).Close)
+
+	return b, nil
+}
+
+func newPackedBackend(data []byte, unmap func() error) (*PackedBackend, error) {
+	if len(data) < packedHeaderSize {
+		return nil, corrupted("packed file is %d bytes, shorter than the header", len(data))
+	}
+	if !bytes.Equal(data[:4], packedMagic[:]) {
+		return nil, corrupted("invalid packed file magic %q", data[:4])
+	}
+	if version := data[4]; version != PackedFormatVersion {
+		return nil, corrupted("unsupported packed file version %d", version)
+	}
+	prefixLength := int(data[5])
+	if prefixLength < 1 || prefixLength > maxPackedPrefixLength {
+		return nil, corrupted("invalid prefix length %d", prefixLength)
+	}
+
+	indexEnd := packedHeaderSize + packedIndexSize(prefixLength)
+	if len(data) < indexEnd {
+		return nil, corrupted("packed file is %d bytes, shorter than the index", len(data))
+	}
+	index := data[packedHeaderSize:indexEnd]
+
+	previous := uint64(indexEnd)
+	for i := 0; i < len(index); i += 8 {
+		offset := binary.BigEndian.Uint64(index[i:])
+		if offset < previous || offset > uint64(len(data)) {
+			return nil, corrupted("invalid offset %d at index entry %d", offset, i/8)
+		}
+		previous = offset
+	}
+
+	return &PackedBackend{
+		data:         data,
+		index:        index,
+		prefixLength: prefixLength,
+		unmap:        unmap,
+	}, nil
+}
+
+// PrefixLength returns the length of keys in the packed file.
+func (b *PackedBackend) PrefixLength() int {
+	return b.prefixLength
+}
+
+func (b *PackedBackend) Read(ctx context.Context, key string) (r io.ReadCloser, err error) {
+	ctx, span := trace.StartSpan(ctx, "PackedBackend.Read")
+	defer tracing.EndSpan(span, &err)
+
+	n, err := parsePackedKey(key, b.prefixLength)
+	if err != nil {
+		return nil, err
+	}
+
+	start := binary.BigEndian.Uint64(b.index[8*n:])
+	end := binary.BigEndian.Uint64(b.index[8*(n+1):])
+	if start == end {
+		return nil, errors.WithMessagef(ErrNotFound, "key '%s' in packed file", key)
+	}
+
+	return &packedReader{
+		Reader:  bytes.NewReader(b.data[start:end]),
+		backend: b,
+	}, nil
+}
+
+// Close unmaps the packed file. The backend must not be used afterwards.
+func (b *PackedBackend) Close() error {
+	b.closeOnce.Do(func() {
+		b.closeErr = b.unmap()
+	})
+	return b.closeErr
+}
+
+// packedReader reads a shard directly from the mapped memory. It keeps a
+// reference to the backend so the mapping outlives the reader.
+type packedReader struct {
+	*bytes.Reader
+	backend *PackedBackend
+}
+
+func (r *packedReader) Close() error {
+	return nil
+}
+
+// PackedWriter writes shards into a packed file. Shards must be written in the
+// order of their keys.
+//
+// The file is written under a temporary name and renamed on Close so readers
+// never observe a partially written packed file.
+type PackedWriter struct {
+	filePath     string
+	f            *os.File
+	w            *bufio.Writer
+	prefixLength int
+	index        []byte
+	offset       uint64
+	next         int
+}
+
+// NewPackedWriter creates a writer for a packed file with keys of the given length.
+func NewPackedWriter(filePath string, prefixLength int) (*PackedWriter, error) {
+	if prefixLength < 1 || prefixLength > maxPackedPrefixLength {
+		return nil, errors.Errorf("prefix length must be between 1 and %d", maxPackedPrefixLength)
+	}
+
+	f, err := ioutil.TempFile(path.Dir(filePath), ".tmp-"+path.Base(filePath))
+	if err != nil {
+		return nil, errors.WithMessage(err, "creating file failed")
+	}
+
+	w := &PackedWriter{
+		filePath:     filePath,
+		f:            f,
+		w:            bufio.NewWriterSize(f, 1024*1024),
+		prefixLength: prefixLength,
+		index:        make([]byte, packedIndexSize(prefixLength)),
+	}
+	w.offset = uint64(packedHeaderSize + len(w.index))
+
+	// The index is only known at the end so the shards are written after space reserved for it.
+	if _, err := f.Seek(int64(w.offset), io.SeekStart); err != nil {
+		w.Abort()
+		return nil, errors.WithMessage(err, "seeking past index failed")
+	}
+
+	return w, nil
+}
+
+// WriteShard appends the encoded shard for the key.
+func (w *PackedWriter) WriteShard(key string, shard []byte) error {
+	n, err := parsePackedKey(key, w.prefixLength)
+	if err != nil {
+		return err
+	}
+	if n < w.next {
+		return errors.Errorf("shard '%s' is written out of order", key)
+	}
+
+	w.fillIndex(n)
+	if _, err := w.w.Write(shard); err != nil {
+		return errors.WithMessagef(err, "writing shard '%s' failed", key)
+	}
+	w.offset += uint64(len(shard))
+	w.next = n + 1
+
+	return nil
+}
+
+// fillIndex sets the start of all prefixes up to and including n to the current offset.
+func (w *PackedWriter) fillIndex(n int) {
+	for ; w.next <= n; w.next++ {
+		binary.BigEndian.PutUint64(w.index[8*w.next:], w.offset)
+	}
+}
+
+// Close writes the index and moves the packed file to its final location.
+func (w *PackedWriter) Close() error {
+	defer os.Remove(w.f.Name())
+
+	w.fillIndex(len(w.index)/8 - 1)
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return errors.WithMessage(err, "writing shards failed")
+	}
+
+	header := make([]byte, packedHeaderSize, packedHeaderSize+len(w.index))
+	copy(header, packedMagic[:])
+	header[4] = PackedFormatVersion
+	header[5] = uint8(w.prefixLength)
+	if _, err := w.f.WriteAt(append(header, w.index...), 0); err != nil {
+		w.f.Close()
+		return errors.WithMessage(err, "writing index failed")
+	}
+
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return errors.WithMessage(err, "syncing file failed")
+	}
+	if err := w.f.Close(); err != nil {
+		return errors.WithMessage(err, "closing file failed")
+	}
+	if err := os.Chmod(w.f.Name(), 0644); err != nil {
+		return errors.WithMessage(err, "changing file mode failed")
+	}
+
+	return errors.WithMessage(os.Rename(w.f.Name(), w.filePath), "renaming file failed")
+}
+
+// Abort discards the partially written packed file.
+func (w *PackedWriter) Abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// OpenLocalStorage opens the dataset in dir from the packed file if the directory
+// contains one and from shard files otherwise.
+func OpenLocalStorage(dir string, hashType HashType) (Storage, error) {
+	packedPath := path.Join(dir, PackedFileName)
+	if _, err := os.Stat(packedPath); os.IsNotExist(err) {
+		return NewLocalStorage(dir, hashType), nil
+	}
+
+	backend, err := OpenPackedBackend(packedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectStorage{
+		Backend:  backend,
+		HashType: hashType,
+	}, nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePacked(t *testing.T, filePath string, prefixLength int, shards map[string][]Hash, keys ...string) {
+	w, err := NewPackedWriter(filePath, prefixLength)
+	require.NoError(t, err)
+	for _, key := range keys {
+		buf, err := EncodeShard(HashTypeSHA1, shards[key])
+		require.NoError(t, err)
+		require.NoError(t, w.WriteShard(key, buf))
+	}
+	require.NoError(t, w.Close())
+}
+
+func TestPackedBackendReadsWrittenShards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packed")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	shards := map[string][]Hash{
+		"00": {{Hash: hashOf(1), Count: 1}},
+		"3f": {{Hash: hashOf(2), Count: 2}, {Hash: hashOf(3), Count: 3}},
+		"ff": {{Hash: hashOf(4), Count: 4}},
+	}
+	filePath := path.Join(dir, PackedFileName)
+	writePacked(t, filePath, 2, shards, "00", "3f", "ff")
+
+	backend, err := OpenPackedBackend(filePath)
+	require.NoError(t, err)
+	defer backend.Close()
+	assert.Equal(t, 2, backend.PrefixLength())
+
+	s := &ObjectStorage{Backend: backend, HashType: HashTypeSHA1}
+	for key, hashes := range shards {
+		result, err := s.Get(context.Background(), key)
+		assert.NoError(t, err)
+		assert.Equal(t, hashes, result, key)
+	}
+
+	_, err = s.GetShard(context.Background(), "40")
+	assert.True(t, IsNotFound(err))
+	_, err = s.Get(context.Background(), "400")
+	assert.Error(t, err)
+	assert.False(t, IsNotFound(err))
+}
+
+func TestPackedWriterRejectsOutOfOrderShards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packed")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewPackedWriter(path.Join(dir, PackedFileName), 2)
+	require.NoError(t, err)
+	defer w.Abort()
+
+	buf, err := EncodeShard(HashTypeSHA1, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteShard("10", buf))
+	assert.Error(t, w.WriteShard("10", buf))
+	assert.Error(t, w.WriteShard("0f", buf))
+}
+
+func TestOpenPackedBackendFailsForCorruptedIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packed")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filePath := path.Join(dir, PackedFileName)
+	writePacked(t, filePath, 1, map[string][]Hash{"a": {{Hash: hashOf(1), Count: 1}}}, "a")
+
+	buf, err := ioutil.ReadFile(filePath)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filePath, buf[:len(buf)-1], 0644))
+
+	_, err = OpenPackedBackend(filePath)
+	assert.True(t, IsCorrupted(err))
+
+	buf[0] = 'X'
+	require.NoError(t, ioutil.WriteFile(filePath, buf, 0644))
+	_, err = OpenPackedBackend(filePath)
+	assert.True(t, IsCorrupted(err))
+}
+
+func TestOpenLocalStoragePrefersPackedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packed")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hashes := []Hash{{Hash: hashOf(1), Count: 7}}
+	s, err := OpenLocalStorage(dir, HashTypeSHA1)
+	require.NoError(t, err)
+	_, err = s.GetShard(context.Background(), "abcde")
+	assert.True(t, IsNotFound(err))
+
+	writePacked(t, path.Join(dir, PackedFileName), 5, map[string][]Hash{"abcde": hashes}, "abcde")
+
+	s, err = OpenLocalStorage(dir, HashTypeSHA1)
+	require.NoError(t, err)
+	result, err := s.Get(context.Background(), "abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, hashes, result)
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const countSize = 4
+
+// AppendRecord appends the encoded hash and its count to buf and returns the extended buffer.
+func AppendRecord(buf []byte, h Hash) []byte {
+	buf = append(buf, h.Hash...)
+	var count [countSize]byte
+	binary.BigEndian.PutUint32(count[:], h.Count)
+	return append(buf, count[:]...)
+}
+
+// decodeRecords decodes consecutive records with hashes of hashSize bytes from buf.
+//
+// A trailing partial record is ignored.
+func decodeRecords(buf []byte, hashSize int) []Hash {
+	recordSize := hashSize + countSize
+	numHashes := len(buf) / recordSize
+	hashes := make([]Hash, 0, numHashes)
+
+	for i := 0; i < numHashes; i++ {
+		record := buf[i*recordSize : (i+1)*recordSize]
+		hashes = append(hashes, Hash{
+			Hash:  record[:hashSize],
+			Count: binary.BigEndian.Uint32(record[hashSize:]),
+		})
+	}
+
+	return hashes
+}
+
+// appendCompactRecord appends the hash front-coded against the previous hash of
+// the shard and its count as a uvarint.
+func appendCompactRecord(buf []byte, previous []byte, h Hash) []byte {
+	shared := 0
+	for shared < len(previous) && shared < len(h.Hash) && previous[shared] == h.Hash[shared] {
+		shared++
+	}
+	buf = append(buf, uint8(shared))
+	buf = append(buf, h.Hash[shared:]...)
+
+	var count [binary.MaxVarintLen32]byte
+	n := binary.PutUvarint(count[:], uint64(h.Count))
+	return append(buf, count[:n]...)
+}
+
+// decodeCompactRecords decodes exactly count compact records with hashes of hashSize
+// bytes from buf.
+func decodeCompactRecords(buf []byte, hashSize int, count int) ([]Hash, error) {
+	// Every record takes at least two bytes so the count can not be trusted blindly.
+	if count > len(buf)/2 {
+		return nil, corrupted("body of %d bytes can not contain %d records", len(buf), count)
+	}
+
+	hashBytes := make([]byte, count*hashSize)
+	hashes := make([]Hash, 0, count)
+	var previous []byte
+
+	for i := 0; i < count; i++ {
+		if len(buf) == 0 {
+			return nil, corrupted("body ends after %d of %d records", i, count)
+		}
+		shared := int(buf[0])
+		if shared > len(previous) || shared > hashSize {
+			return nil, corrupted("record %d shares %d bytes with the previous hash", i, shared)
+		}
+		rest := hashSize - shared
+		if len(buf) < 1+rest {
+			return nil, corrupted("record %d is truncated", i)
+		}
+
+		hash := hashBytes[i*hashSize : (i+1)*hashSize : (i+1)*hashSize]
+		copy(hash, previous[:shared])
+		copy(hash[shared:], buf[1:1+rest])
+		buf = buf[1+rest:]
+
+		c, n := binary.Uvarint(buf)
+		if n <= 0 || c > math.MaxUint32 {
+			return nil, corrupted("record %d has an invalid count", i)
+		}
+		buf = buf[n:]
+
+		hashes = append(hashes, Hash{Hash: hash, Count: uint32(c)})
+		previous = hash
+	}
+
+	if len(buf) != 0 {
+		return nil, corrupted("body has %d trailing bytes", len(buf))
+	}
+
+	return hashes, nil
+}
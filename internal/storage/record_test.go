@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hashOf(b byte) []byte {
+	return bytes.Repeat([]byte{b}, HashTypeSHA1.Size())
+}
+
+func ntlmHashOf(b byte) []byte {
+	return bytes.Repeat([]byte{b}, HashTypeNTLM.Size())
+}
+
+func TestAppendRecordAndDecodeRecords(t *testing.T) {
+	hashes := []Hash{
+		{Hash: hashOf(1), Count: 1},
+		{Hash: hashOf(2), Count: 3861493},
+	}
+
+	var buf []byte
+	for _, h := range hashes {
+		buf = AppendRecord(buf, h)
+	}
+
+	assert.Len(t, buf, 2*HashTypeSHA1.RecordSize())
+	assert.Equal(t, hashes, decodeRecords(buf, HashTypeSHA1.Size()))
+}
+
+func TestDecodeRecordsIgnoresPartialRecord(t *testing.T) {
+	buf := AppendRecord(nil, Hash{Hash: hashOf(1), Count: 7})
+	buf = append(buf, 1, 2, 3)
+
+	assert.Equal(t, []Hash{{Hash: hashOf(1), Count: 7}}, decodeRecords(buf, HashTypeSHA1.Size()))
+}
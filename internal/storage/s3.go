@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arjantop/pwned-passwords/internal/tracing"
+	"github.com/pkg/errors"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/trace"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Backend is a storage backend that reads objects from an S3 compatible object storage.
+//
+// Objects are addressed path-style as Endpoint/Bucket/Prefix/PathFor(key, ".bin") so
+// a data directory can be uploaded to a bucket as is.
+type S3Backend struct {
+	// Endpoint is the base URL of the object storage, for example https://s3.eu-west-1.amazonaws.com.
+	Endpoint string
+	Bucket   string
+	// Prefix is an optional directory in the bucket containing the shards.
+	Prefix string
+	Region string
+	// Requests are not signed if AccessKeyID is not set.
+	AccessKeyID     string
+	SecretAccessKey string
+	// Client is used for all requests. A client that propagates trace spans is used if not set.
+	Client *http.Client
+}
+
+var defaultS3Client = &http.Client{
+	Transport: &ochttp.Transport{},
+}
+
+func (s *S3Backend) Read(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return s.ReadObject(ctx, PathFor(key, ".bin"))
+}
+
+// ReadObject reads the object with the given name relative to Prefix, for example
+// the manifest of the dataset.
+func (s *S3Backend) ReadObject(ctx context.Context, name string) (r io.ReadCloser, err error) {
+	ctx, span := trace.StartSpan(ctx, "S3Backend.Read")
+	defer tracing.EndSpan(span, &err)
+
+	objectKey := path.Join(s.Prefix, name)
+	span.AddAttributes(trace.StringAttribute("key", objectKey))
+
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/") + "/" + path.Join(s.Bucket, objectKey))
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid object URL")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.WithMessage(err, "creating request failed")
+	}
+	req = req.WithContext(ctx)
+	if s.AccessKeyID != "" {
+		signV4(req, s.AccessKeyID, s.SecretAccessKey, s.Region, "s3", time.Now())
+	}
+
+	client := s.Client
+	if client == nil {
+		client = defaultS3Client
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.WithMessagef(ctx.Err(), "fetching object '%s' failed", objectKey)
+		}
+		// The object storage could not be reached.
+		return nil, errors.WithMessagef(&TransientError{err}, "fetching object '%s' failed", objectKey)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errors.WithMessagef(ErrNotFound, "object '%s'", objectKey)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		resp.Body.Close()
+		return nil, &TransientError{errors.Errorf("fetching object '%s' failed with status %s", objectKey, resp.Status)}
+	default:
+		resp.Body.Close()
+		return nil, errors.Errorf("fetching object '%s' failed with status %s", objectKey, resp.Status)
+	}
+}
+
+// signV4 signs the request with AWS Signature Version 4. The host and all headers
+// already set on the request are signed.
+func signV4(req *http.Request, accessKeyID, secretAccessKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape escapes everything except unreserved characters as required by the signature.
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+)
+
+// A shard is stored as a fixed size header followed by the body of sorted records.
+// All integers are big-endian:
+//
+//	magic       [4]byte  "PWPS"
+//	version     uint8    format version
+//	hashType    uint8    hash algorithm of the records
+//	recordSize  uint16   size of a single decoded record in bytes
+//	recordCount uint32   number of records in the body
+//	checksum    uint32   CRC-32 (Castagnoli) of the body
+//
+// The format version determines the encoding of the records in the body.
+const (
+	ShardFormatVersion        = 1
+	CompactShardFormatVersion = 2
+	ShardHeaderSize           = 16
+)
+
+// ShardEncoding identifies how records are encoded in the body of a shard.
+type ShardEncoding uint8
+
+const (
+	// ShardEncodingRaw stores every record as the full hash followed by its count
+	// as a big-endian uint32.
+	ShardEncodingRaw ShardEncoding = ShardFormatVersion
+	// ShardEncodingCompact front-codes sorted hashes. Every record stores the number
+	// of leading bytes shared with the previous hash, the remaining bytes of the hash
+	// and its count as a uvarint. Bytes of the prefix shared by all hashes of a shard
+	// are only stored once.
+	ShardEncodingCompact ShardEncoding = CompactShardFormatVersion
+)
+
+// ParseShardEncoding parses the name of an encoding as returned by ShardEncoding.String.
+func ParseShardEncoding(s string) (ShardEncoding, error) {
+	switch s {
+	case "raw":
+		return ShardEncodingRaw, nil
+	case "compact":
+		return ShardEncodingCompact, nil
+	default:
+		return 0, fmt.Errorf("unknown shard encoding '%s'", s)
+	}
+}
+
+func (e ShardEncoding) String() string {
+	switch e {
+	case ShardEncodingRaw:
+		return "raw"
+	case ShardEncodingCompact:
+		return "compact"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(e))
+	}
+}
+
+var shardMagic = [4]byte{'P', 'W', 'P', 'S'}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (e ShardEncoding) MarshalText() ([]byte, error) {
+	if e != ShardEncodingRaw && e != ShardEncodingCompact {
+		return nil, fmt.Errorf("unknown shard encoding %s", e)
+	}
+	return []byte(e.String()), nil
+}
+
+func (e *ShardEncoding) UnmarshalText(text []byte) error {
+	parsed, err := ParseShardEncoding(string(text))
+	if err != nil {
+		return err
+	}
+	*e = parsed
+	return nil
+}
+
+// ShardHeader describes the body of a shard.
+type ShardHeader struct {
+	Version     uint8
+	HashType    HashType
+	RecordSize  uint16
+	RecordCount uint32
+	Checksum    uint32
+}
+
+// Encoding returns the encoding of the records in the body.
+func (h ShardHeader) Encoding() ShardEncoding {
+	return ShardEncoding(h.Version)
+}
+
+// CorruptionError is returned when a shard does not match its header.
+type CorruptionError struct {
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	return "corrupted shard: " + e.Reason
+}
+
+func corrupted(format string, args ...interface{}) error {
+	return &CorruptionError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// IsCorrupted reports whether the cause of err is a CorruptionError.
+func IsCorrupted(err error) bool {
+	_, ok := errors.Cause(err).(*CorruptionError)
+	return ok
+}
+
+// EncodeShard encodes hashes of the given type into a shard with a header using
+// the raw encoding.
+func EncodeShard(hashType HashType, hashes []Hash) ([]byte, error) {
+	return EncodeShardWith(ShardEncodingRaw, hashType, hashes)
+}
+
+// EncodeShardWith encodes hashes of the given type into a shard with a header
+// using the given encoding. Hashes must be sorted for the compact encoding to be
+// effective.
+func EncodeShardWith(encoding ShardEncoding, hashType HashType, hashes []Hash) ([]byte, error) {
+	if !hashType.Valid() {
+		return nil, fmt.Errorf("unknown hash type %s", hashType)
+	}
+	if encoding != ShardEncodingRaw && encoding != ShardEncodingCompact {
+		return nil, fmt.Errorf("unknown shard encoding %s", encoding)
+	}
+
+	buf := make([]byte, ShardHeaderSize, ShardHeaderSize+len(hashes)*hashType.RecordSize())
+	var previous []byte
+	for _, h := range hashes {
+		if len(h.Hash) != hashType.Size() {
+			return nil, fmt.Errorf("hash %x is not a valid %s hash", h.Hash, hashType)
+		}
+		if encoding == ShardEncodingCompact {
+			buf = appendCompactRecord(buf, previous, h)
+			previous = h.Hash
+		} else {
+			buf = AppendRecord(buf, h)
+		}
+	}
+
+	encodeShardHeader(buf[:ShardHeaderSize], ShardHeader{
+		Version:     uint8(encoding),
+		HashType:    hashType,
+		RecordSize:  uint16(hashType.RecordSize()),
+		RecordCount: uint32(len(hashes)),
+		Checksum:    crc32.Checksum(buf[ShardHeaderSize:], crcTable),
+	})
+
+	return buf, nil
+}
+
+func encodeShardHeader(buf []byte, h ShardHeader) {
+	copy(buf[0:4], shardMagic[:])
+	buf[4] = h.Version
+	buf[5] = uint8(h.HashType)
+	binary.BigEndian.PutUint16(buf[6:8], h.RecordSize)
+	binary.BigEndian.PutUint32(buf[8:12], h.RecordCount)
+	binary.BigEndian.PutUint32(buf[12:16], h.Checksum)
+}
+
+// DecodeShardHeader decodes and validates the header at the start of buf.
+func DecodeShardHeader(buf []byte) (ShardHeader, error) {
+	if len(buf) < ShardHeaderSize {
+		return ShardHeader{}, corrupted("header too short (%d bytes)", len(buf))
+	}
+	if string(buf[0:4]) != string(shardMagic[:]) {
+		return ShardHeader{}, corrupted("invalid magic %q", buf[0:4])
+	}
+
+	h := ShardHeader{
+		Version:     buf[4],
+		HashType:    HashType(buf[5]),
+		RecordSize:  binary.BigEndian.Uint16(buf[6:8]),
+		RecordCount: binary.BigEndian.Uint32(buf[8:12]),
+		Checksum:    binary.BigEndian.Uint32(buf[12:16]),
+	}
+
+	if h.Version != ShardFormatVersion && h.Version != CompactShardFormatVersion {
+		return ShardHeader{}, corrupted("unsupported format version %d", h.Version)
+	}
+	if !h.HashType.Valid() {
+		return ShardHeader{}, corrupted("unsupported hash type %s", h.HashType)
+	}
+	if int(h.RecordSize) != h.HashType.RecordSize() {
+		return ShardHeader{}, corrupted("record size %d does not match hash type %s", h.RecordSize, h.HashType)
+	}
+
+	return h, nil
+}
+
+// DecodeShard validates the shard in buf and returns its header and the hashes it contains.
+func DecodeShard(buf []byte) (ShardHeader, []Hash, error) {
+	h, err := DecodeShardHeader(buf)
+	if err != nil {
+		return ShardHeader{}, nil, err
+	}
+
+	body := buf[ShardHeaderSize:]
+	if h.Encoding() == ShardEncodingRaw {
+		if expected := int(h.RecordCount) * int(h.RecordSize); len(body) != expected {
+			return ShardHeader{}, nil, corrupted("body has %d bytes, expected %d", len(body), expected)
+		}
+	}
+	if checksum := crc32.Checksum(body, crcTable); checksum != h.Checksum {
+		return ShardHeader{}, nil, corrupted("checksum %08x does not match %08x", checksum, h.Checksum)
+	}
+
+	if h.Encoding() == ShardEncodingCompact {
+		hashes, err := decodeCompactRecords(body, h.HashType.Size(), int(h.RecordCount))
+		if err != nil {
+			return ShardHeader{}, nil, err
+		}
+		return h, hashes, nil
+	}
+
+	return h, decodeRecords(body, h.HashType.Size()), nil
+}
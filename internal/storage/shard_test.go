@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash/crc32"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeShardAndDecodeShard(t *testing.T) {
+	hashes := []Hash{
+		{Hash: hashOf(1), Count: 1},
+		{Hash: hashOf(2), Count: 42},
+	}
+
+	buf, err := EncodeShard(HashTypeSHA1, hashes)
+	assert.NoError(t, err)
+	assert.Len(t, buf, ShardHeaderSize+2*HashTypeSHA1.RecordSize())
+
+	h, err := DecodeShardHeader(buf)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint8(ShardFormatVersion), h.Version)
+		assert.Equal(t, HashTypeSHA1, h.HashType)
+		assert.Equal(t, uint16(HashTypeSHA1.RecordSize()), h.RecordSize)
+		assert.Equal(t, uint32(2), h.RecordCount)
+	}
+
+	_, decoded, err := DecodeShard(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, hashes, decoded)
+}
+
+func TestEncodeShardAndDecodeShardWithNTLMHashes(t *testing.T) {
+	hashes := []Hash{
+		{Hash: ntlmHashOf(1), Count: 5},
+	}
+
+	buf, err := EncodeShard(HashTypeNTLM, hashes)
+	assert.NoError(t, err)
+	assert.Len(t, buf, ShardHeaderSize+HashTypeNTLM.RecordSize())
+
+	h, decoded, err := DecodeShard(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, HashTypeNTLM, h.HashType)
+	assert.Equal(t, hashes, decoded)
+}
+
+func TestEncodeShardFailsOnHashOfInvalidSize(t *testing.T) {
+	_, err := EncodeShard(HashTypeNTLM, []Hash{{Hash: hashOf(1), Count: 1}})
+	assert.Error(t, err)
+}
+
+func TestDecodeShardOfEmptyShard(t *testing.T) {
+	buf, err := EncodeShard(HashTypeSHA1, nil)
+	assert.NoError(t, err)
+
+	_, decoded, err := DecodeShard(buf)
+	assert.NoError(t, err)
+	assert.Empty(t, decoded)
+}
+
+func TestDecodeShardFailsOnCorruption(t *testing.T) {
+	valid, err := EncodeShard(HashTypeSHA1, []Hash{
+		{Hash: hashOf(1), Count: 1},
+		{Hash: hashOf(2), Count: 2},
+	})
+	assert.NoError(t, err)
+	modified := func(f func(buf []byte) []byte) []byte {
+		buf := append([]byte(nil), valid...)
+		return f(buf)
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"truncated header", valid[:ShardHeaderSize-1]},
+		{"truncated body", valid[:len(valid)-1]},
+		{"trailing data", append(append([]byte(nil), valid...), 0)},
+		{"invalid magic", modified(func(buf []byte) []byte { buf[0] = 'X'; return buf })},
+		{"unknown version", modified(func(buf []byte) []byte { buf[4] = 99; return buf })},
+		{"unknown hash type", modified(func(buf []byte) []byte { buf[5] = 99; return buf })},
+		{"invalid record size", modified(func(buf []byte) []byte { buf[7]++; return buf })},
+		{"checksum mismatch", modified(func(buf []byte) []byte { buf[len(buf)-1]++; return buf })},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := DecodeShard(tc.buf)
+			assert.Error(t, err)
+			assert.True(t, IsCorrupted(err))
+		})
+	}
+}
+
+// sortedHashesWithPrefix returns n sorted SHA-1 hashes sharing the first 20 bits like
+// the hashes of a single shard.
+func sortedHashesWithPrefix(n int) []Hash {
+	hashes := make([]Hash, 0, n)
+	for i := 0; i < n; i++ {
+		sum := sha1.Sum([]byte{byte(i), byte(i >> 8)})
+		sum[0], sum[1], sum[2] = 0xab, 0xcd, 0xe0|sum[2]&0x0f
+		hashes = append(hashes, Hash{Hash: sum[:], Count: uint32(i%50 + 1)})
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i].Hash, hashes[j].Hash) < 0
+	})
+	return hashes
+}
+
+func TestEncodeShardWithCompactEncodingAndDecodeShard(t *testing.T) {
+	hashes := sortedHashesWithPrefix(800)
+
+	raw, err := EncodeShard(HashTypeSHA1, hashes)
+	require.NoError(t, err)
+	compact, err := EncodeShardWith(ShardEncodingCompact, HashTypeSHA1, hashes)
+	require.NoError(t, err)
+	assert.True(t, len(compact) < len(raw)*85/100, "compact shard of %d bytes, raw shard of %d bytes", len(compact), len(raw))
+
+	h, decoded, err := DecodeShard(compact)
+	assert.NoError(t, err)
+	assert.Equal(t, ShardEncodingCompact, h.Encoding())
+	assert.Equal(t, uint32(len(hashes)), h.RecordCount)
+	assert.Equal(t, hashes, decoded)
+
+	empty, err := EncodeShardWith(ShardEncodingCompact, HashTypeNTLM, nil)
+	require.NoError(t, err)
+	_, decoded, err = DecodeShard(empty)
+	assert.NoError(t, err)
+	assert.Empty(t, decoded)
+}
+
+func TestDecodeShardFailsOnCorruptedCompactBody(t *testing.T) {
+	valid, err := EncodeShardWith(ShardEncodingCompact, HashTypeSHA1, []Hash{
+		{Hash: hashOf(1), Count: 1},
+		{Hash: hashOf(2), Count: 300},
+	})
+	require.NoError(t, err)
+	// Body modifications keep the checksum valid to exercise decoding of records.
+	modified := func(f func(buf []byte) []byte) []byte {
+		buf := f(append([]byte(nil), valid...))
+		binary.BigEndian.PutUint32(buf[12:16], crc32.Checksum(buf[ShardHeaderSize:], crcTable))
+		return buf
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"truncated record", modified(func(buf []byte) []byte { return buf[:len(buf)-3] })},
+		{"trailing data", modified(func(buf []byte) []byte { return append(buf, 0) })},
+		{"shared bytes without previous hash", modified(func(buf []byte) []byte { buf[ShardHeaderSize] = 1; return buf })},
+		{"too many records", modified(func(buf []byte) []byte { buf[11] = 3; return buf })},
+		{"huge record count", modified(func(buf []byte) []byte { buf[8] = 0xff; return buf })},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := DecodeShard(tc.buf)
+			assert.True(t, IsCorrupted(err))
+		})
+	}
+}
+
+func TestParseShardEncoding(t *testing.T) {
+	for _, e := range []ShardEncoding{ShardEncodingRaw, ShardEncodingCompact} {
+		parsed, err := ParseShardEncoding(e.String())
+		assert.NoError(t, err)
+		assert.Equal(t, e, parsed)
+	}
+
+	_, err := ParseShardEncoding("gzip")
+	assert.Error(t, err)
+}
@@ -5,8 +5,11 @@ import (
 	"context"
 	"io"
 	"io/ioutil"
+	"net/url"
+	"os"
 
 	"github.com/arjantop/pwned-passwords/internal/tracing"
+	"github.com/pkg/errors"
 	"go.opencensus.io/trace"
 )
 
@@ -16,37 +19,114 @@ import (
 // A Backend is used by Storage to request underlying data.
 type Backend interface {
 	// Read returns a io.ReadCloser for the requested key.
-	Read(ctx context.Context, key string) io.ReadCloser
+	//
+	// An error with ErrNotFound as the cause is returned if there is no data for
+	// the key. Failures that may succeed on retry satisfy IsTransient.
+	Read(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// ErrNotFound is the cause of errors returned when there is no data for a key.
+var ErrNotFound = errors.New("not found")
+
+// TransientError is returned for failures that may succeed if the request is retried.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return "transient failure: " + e.Err.Error()
+}
+
+// IsTransient reports whether the cause of err is a TransientError.
+func IsTransient(err error) bool {
+	_, ok := errors.Cause(err).(*TransientError)
+	return ok
+}
+
+// wrapTemporary marks err as transient if the underlying failure is temporary.
+func wrapTemporary(err error) error {
+	cause := errors.Cause(err)
+	switch e := cause.(type) {
+	case *os.PathError:
+		cause = e.Err
+	case *url.Error:
+		cause = e.Err
+	}
+	if t, ok := cause.(interface{ Temporary() bool }); ok && t.Temporary() {
+		return &TransientError{err}
+	}
+	return err
+}
+
+// Hash is a password hash together with the number of times it has been seen in breaches.
+type Hash struct {
+	Hash  []byte
+	Count uint32
 }
 
 type Storage interface {
-	Get(ctx context.Context, key string) (result [][]byte, err error)
+	Get(ctx context.Context, key string) (result []Hash, err error)
+	// GetShard returns the validated encoded shard for the key.
+	GetShard(ctx context.Context, key string) (shard []byte, err error)
+}
+
+// IsNotFound reports whether err was caused by a missing shard.
+func IsNotFound(err error) bool {
+	return errors.Cause(err) == ErrNotFound
 }
 
 // ObjectStorage provides access to hashes based on a key from a Backend.
 type ObjectStorage struct {
 	Backend Backend
+	// HashType is the expected hash type of all shards. Shards of any known
+	// hash type are accepted if it is not set.
+	HashType HashType
 }
 
-// Get return a list of hashes.
-func (s *ObjectStorage) Get(ctx context.Context, key string) (result [][]byte, err error) {
+// Get return a list of hashes. The list is empty if the Backend has no shard for the key.
+//
+// An error satisfying IsCorrupted is returned if the stored shard fails validation.
+func (s *ObjectStorage) Get(ctx context.Context, key string) (result []Hash, err error) {
 	ctx, span := trace.StartSpan(ctx, "ObjectStorage.Get")
 	defer tracing.EndSpan(span, &err)
 
-	r := s.Backend.Read(ctx, key)
+	_, hashes, err := s.readShard(ctx, key)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	return hashes, err
+}
+
+// GetShard returns the encoded shard after validating it.
+//
+// An error satisfying IsNotFound is returned if the Backend has no shard for the key.
+func (s *ObjectStorage) GetShard(ctx context.Context, key string) (shard []byte, err error) {
+	ctx, span := trace.StartSpan(ctx, "ObjectStorage.GetShard")
+	defer tracing.EndSpan(span, &err)
+
+	buf, _, err := s.readShard(ctx, key)
+	return buf, err
+}
+
+func (s *ObjectStorage) readShard(ctx context.Context, key string) ([]byte, []Hash, error) {
+	r, err := s.Backend.Read(ctx, key)
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "reading shard '%s' failed", key)
+	}
 	defer r.Close()
 
 	buf, err := ioutil.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, errors.WithMessagef(wrapTemporary(err), "reading shard '%s' failed", key)
 	}
 
-	numHashes := len(buf) / 20
-	hashes := make([][]byte, 0, numHashes)
-
-	for i := 0; i < numHashes; i++ {
-		hashes = append(hashes, buf[i*20:(i+1)*20])
+	header, hashes, err := DecodeShard(buf)
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "decoding shard '%s' failed", key)
+	}
+	if s.HashType != 0 && header.HashType != s.HashType {
+		return nil, nil, errors.Errorf("shard '%s' contains %s hashes, expected %s", key, header.HashType, s.HashType)
 	}
 
-	return hashes, err
+	return buf, hashes, nil
 }
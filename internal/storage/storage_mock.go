@@ -35,10 +35,11 @@ func (m *MockBackend) EXPECT() *MockBackendMockRecorder {
 }
 
 // Read mocks base method
-func (m *MockBackend) Read(ctx context.Context, key string) io.ReadCloser {
+func (m *MockBackend) Read(ctx context.Context, key string) (io.ReadCloser, error) {
 	ret := m.ctrl.Call(m, "Read", ctx, key)
 	ret0, _ := ret[0].(io.ReadCloser)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Read indicates an expected call of Read
@@ -70,9 +71,9 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 }
 
 // Get mocks base method
-func (m *MockStorage) Get(ctx context.Context, key string) ([][]byte, error) {
+func (m *MockStorage) Get(ctx context.Context, key string) ([]Hash, error) {
 	ret := m.ctrl.Call(m, "Get", ctx, key)
-	ret0, _ := ret[0].([][]byte)
+	ret0, _ := ret[0].([]Hash)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -81,3 +82,16 @@ func (m *MockStorage) Get(ctx context.Context, key string) ([][]byte, error) {
 func (mr *MockStorageMockRecorder) Get(ctx, key interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStorage)(nil).Get), ctx, key)
 }
+
+// GetShard mocks base method
+func (m *MockStorage) GetShard(ctx context.Context, key string) ([]byte, error) {
+	ret := m.ctrl.Call(m, "GetShard", ctx, key)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetShard indicates an expected call of GetShard
+func (mr *MockStorageMockRecorder) GetShard(ctx, key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetShard", reflect.TypeOf((*MockStorage)(nil).GetShard), ctx, key)
+}
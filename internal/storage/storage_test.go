@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectStorageGetReturnsHashesWithCounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	buf, err := EncodeShard(HashTypeSHA1, []Hash{
+		{Hash: hashOf(1), Count: 10},
+		{Hash: hashOf(2), Count: 20},
+	})
+	assert.NoError(t, err)
+
+	backend := NewMockBackend(ctrl)
+	backend.EXPECT().Read(gomock.Any(), "abcde").Return(ioutil.NopCloser(bytes.NewReader(buf)), nil)
+
+	s := &ObjectStorage{Backend: backend}
+	hashes, err := s.Get(context.Background(), "abcde")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Hash{
+		{Hash: hashOf(1), Count: 10},
+		{Hash: hashOf(2), Count: 20},
+	}, hashes)
+}
+
+func TestObjectStorageGetFailsOnTruncatedShard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	buf, err := EncodeShard(HashTypeSHA1, []Hash{
+		{Hash: hashOf(1), Count: 10},
+		{Hash: hashOf(2), Count: 20},
+	})
+	assert.NoError(t, err)
+
+	backend := NewMockBackend(ctrl)
+	backend.EXPECT().Read(gomock.Any(), "abcde").Return(ioutil.NopCloser(bytes.NewReader(buf[:len(buf)-5])), nil)
+
+	s := &ObjectStorage{Backend: backend}
+	_, err = s.Get(context.Background(), "abcde")
+
+	if assert.Error(t, err) {
+		assert.True(t, IsCorrupted(err))
+		assert.Contains(t, err.Error(), "abcde")
+	}
+}
+
+func TestObjectStorageGetFailsOnHashTypeMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	buf, err := EncodeShard(HashTypeNTLM, []Hash{
+		{Hash: ntlmHashOf(1), Count: 10},
+	})
+	assert.NoError(t, err)
+
+	backend := NewMockBackend(ctrl)
+	backend.EXPECT().Read(gomock.Any(), "abcde").Return(ioutil.NopCloser(bytes.NewReader(buf)), nil)
+
+	s := &ObjectStorage{Backend: backend, HashType: HashTypeSHA1}
+	_, err = s.Get(context.Background(), "abcde")
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "ntlm")
+	}
+}
+
+func TestObjectStorageGetShardReturnsValidatedShard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	buf, err := EncodeShard(HashTypeSHA1, []Hash{
+		{Hash: hashOf(1), Count: 10},
+	})
+	assert.NoError(t, err)
+
+	backend := NewMockBackend(ctrl)
+	backend.EXPECT().Read(gomock.Any(), "abcde").Return(ioutil.NopCloser(bytes.NewReader(buf)), nil)
+	backend.EXPECT().Read(gomock.Any(), "bcdef").Return(ioutil.NopCloser(bytes.NewReader(buf[:len(buf)-1])), nil)
+
+	s := &ObjectStorage{Backend: backend}
+
+	shard, err := s.GetShard(context.Background(), "abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, buf, shard)
+
+	_, err = s.GetShard(context.Background(), "bcdef")
+	assert.True(t, IsCorrupted(err))
+}
+
+func TestObjectStorageGetReturnsEmptyResultForMissingShard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backend := NewMockBackend(ctrl)
+	backend.EXPECT().Read(gomock.Any(), "abcde").Return(nil, ErrNotFound).Times(2)
+
+	s := &ObjectStorage{Backend: backend}
+
+	hashes, err := s.Get(context.Background(), "abcde")
+	assert.NoError(t, err)
+	assert.Empty(t, hashes)
+
+	_, err = s.GetShard(context.Background(), "abcde")
+	assert.True(t, IsNotFound(err))
+}
+
+func TestObjectStorageGetPropagatesBackendFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backend := NewMockBackend(ctrl)
+	backend.EXPECT().Read(gomock.Any(), "abcde").Return(nil, &TransientError{errors.New("timeout")})
+	backend.EXPECT().Read(gomock.Any(), "bcdef").Return(nil, errors.New("access denied"))
+
+	s := &ObjectStorage{Backend: backend}
+
+	_, err := s.Get(context.Background(), "abcde")
+	assert.True(t, IsTransient(err))
+	assert.False(t, IsNotFound(err))
+
+	_, err = s.Get(context.Background(), "bcdef")
+	if assert.Error(t, err) {
+		assert.False(t, IsTransient(err))
+		assert.Contains(t, err.Error(), "bcdef")
+	}
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/arjantop/pwned-passwords/internal/tracing"
+	"github.com/pkg/errors"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+var (
+	tierReadLatency = stats.Float64("pwnedpasswords/tier_read_latency", "Latency of reads from a backend tier", stats.UnitMilliseconds)
+	tierWrites      = stats.Int64("pwnedpasswords/tier_writes", "Number of shards written through to a backend tier", stats.UnitDimensionless)
+
+	keyTier, _       = tag.NewKey("tier")
+	keyTierResult, _ = tag.NewKey("result")
+
+	TierReadLatencyView = &view.View{
+		Name:        "pwnedpasswords/tier_read_latency",
+		Description: "Distribution of read latencies by tier and result",
+		Measure:     tierReadLatency,
+		TagKeys:     []tag.Key{keyTier, keyTierResult},
+		Aggregation: view.Distribution(0, 1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000),
+	}
+	TierWriteCountView = &view.View{
+		Name:        "pwnedpasswords/tier_write_count",
+		Description: "Count of shards written through to a tier by result",
+		Measure:     tierWrites,
+		TagKeys:     []tag.Key{keyTier, keyTierResult},
+		Aggregation: view.Count(),
+	}
+
+	// TierViews are all views of the tiered backend statistics.
+	TierViews = []*view.View{TierReadLatencyView, TierWriteCountView}
+)
+
+// WritableBackend is a Backend that can also store data for a key.
+type WritableBackend interface {
+	Backend
+	// Write stores data for the key so it is returned by subsequent reads.
+	Write(ctx context.Context, key string, data []byte) error
+}
+
+// Tier is a named backend of a TieredBackend.
+type Tier struct {
+	// Name identifies the tier in metrics and traces.
+	Name    string
+	Backend Backend
+}
+
+// TieredBackend is a Backend that reads from a list of tiers ordered from the fastest
+// to the slowest and returns data from the first tier that has it.
+//
+// A tier that fails is skipped but its error is returned if no later tier has the
+// data, because the data can not be reported as missing in that case.
+type TieredBackend struct {
+	Tiers []Tier
+	// WriteThrough writes data found in a slower tier to all faster tiers that
+	// implement WritableBackend. Failed writes do not fail the read.
+	WriteThrough bool
+}
+
+func (b *TieredBackend) Read(ctx context.Context, key string) (r io.ReadCloser, err error) {
+	ctx, span := trace.StartSpan(ctx, "TieredBackend.Read")
+	defer tracing.EndSpan(span, &err)
+
+	var tierErr error
+	for i, tier := range b.Tiers {
+		start := time.Now()
+		r, err := tier.Backend.Read(ctx, key)
+		recordTierRead(ctx, tier.Name, start, err)
+
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			span.Annotatef([]trace.Attribute{trace.StringAttribute("tier", tier.Name)}, "Tier failed: %v", err)
+			if tierErr == nil {
+				tierErr = errors.WithMessagef(err, "reading from tier '%s' failed", tier.Name)
+			}
+			continue
+		}
+
+		span.AddAttributes(trace.StringAttribute("tier", tier.Name))
+		if !b.WriteThrough || i == 0 {
+			return r, nil
+		}
+		return b.writeThrough(ctx, key, r, b.Tiers[:i])
+	}
+
+	if tierErr != nil {
+		return nil, tierErr
+	}
+	return nil, errors.WithMessagef(ErrNotFound, "key '%s' in any tier", key)
+}
+
+// writeThrough writes the data read from r to the given faster tiers.
+func (b *TieredBackend) writeThrough(ctx context.Context, key string, r io.ReadCloser, tiers []Tier) (io.ReadCloser, error) {
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.WithMessage(wrapTemporary(err), "reading data for write-through failed")
+	}
+	if _, _, err := DecodeShard(data); err != nil {
+		// Corrupted data is not spread to other tiers. It is still returned so
+		// the reader can report the corruption.
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	for _, tier := range tiers {
+		w, ok := tier.Backend.(WritableBackend)
+		if !ok {
+			continue
+		}
+
+		result := "success"
+		if err := w.Write(ctx, key, data); err != nil {
+			result = "failure"
+			trace.FromContext(ctx).Annotatef([]trace.Attribute{trace.StringAttribute("tier", tier.Name)}, "Write-through failed: %v", err)
+		}
+		tierCtx, _ := tag.New(ctx, tag.Upsert(keyTier, tier.Name), tag.Upsert(keyTierResult, result))
+		stats.Record(tierCtx, tierWrites.M(1))
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func recordTierRead(ctx context.Context, tier string, start time.Time, err error) {
+	result := "hit"
+	if IsNotFound(err) {
+		result = "miss"
+	} else if err != nil {
+		result = "error"
+	}
+
+	ctx, _ = tag.New(ctx, tag.Upsert(keyTier, tier), tag.Upsert(keyTierResult, result))
+	stats.Record(ctx, tierReadLatency.M(float64(time.Since(start))/float64(time.Millisecond)))
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredBackendReadsFromFirstTierWithData(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	buf, err := EncodeShard(HashTypeSHA1, []Hash{{Hash: hashOf(1), Count: 1}})
+	require.NoError(t, err)
+
+	fast, slow := NewMockBackend(ctrl), NewMockBackend(ctrl)
+	fast.EXPECT().Read(gomock.Any(), "abcde").Return(ioutil.NopCloser(bytes.NewReader(buf)), nil)
+	fast.EXPECT().Read(gomock.Any(), "bcdef").Return(nil, ErrNotFound)
+	slow.EXPECT().Read(gomock.Any(), "bcdef").Return(ioutil.NopCloser(bytes.NewReader(buf)), nil)
+	fast.EXPECT().Read(gomock.Any(), "cdefa").Return(nil, ErrNotFound)
+	slow.EXPECT().Read(gomock.Any(), "cdefa").Return(nil, ErrNotFound)
+
+	s := &ObjectStorage{Backend: &TieredBackend{Tiers: []Tier{{"fast", fast}, {"slow", slow}}}}
+
+	for _, key := range []string{"abcde", "bcdef"} {
+		shard, err := s.GetShard(context.Background(), key)
+		assert.NoError(t, err)
+		assert.Equal(t, buf, shard)
+	}
+
+	_, err = s.GetShard(context.Background(), "cdefa")
+	assert.True(t, IsNotFound(err))
+}
+
+func TestTieredBackendReturnsTierErrorIfNoOtherTierHasData(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fast, slow := NewMockBackend(ctrl), NewMockBackend(ctrl)
+	fast.EXPECT().Read(gomock.Any(), "abcde").Return(nil, ErrNotFound)
+	slow.EXPECT().Read(gomock.Any(), "abcde").Return(nil, &TransientError{errors.New("timeout")})
+
+	s := &ObjectStorage{Backend: &TieredBackend{Tiers: []Tier{{"fast", fast}, {"slow", slow}}}}
+
+	_, err := s.Get(context.Background(), "abcde")
+	assert.True(t, IsTransient(err))
+	assert.Contains(t, err.Error(), "slow")
+}
+
+func TestTieredBackendWritesThroughToFasterTiers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "tiered")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hashes := []Hash{{Hash: hashOf(1), Count: 1}}
+	buf, err := EncodeShard(HashTypeSHA1, hashes)
+	require.NoError(t, err)
+
+	slow := NewMockBackend(ctrl)
+	slow.EXPECT().Read(gomock.Any(), "abcde").Return(ioutil.NopCloser(bytes.NewReader(buf)), nil).Times(1)
+	slow.EXPECT().Read(gomock.Any(), "bcdef").Return(ioutil.NopCloser(bytes.NewReader(buf[:len(buf)-1])), nil)
+
+	s := &ObjectStorage{Backend: &TieredBackend{
+		Tiers:        []Tier{{"local", &LocalBackend{Dir: dir}}, {"slow", slow}},
+		WriteThrough: true,
+	}}
+
+	for i := 0; i < 2; i++ {
+		result, err := s.Get(context.Background(), "abcde")
+		assert.NoError(t, err)
+		assert.Equal(t, hashes, result)
+	}
+
+	_, err = s.Get(context.Background(), "bcdef")
+	assert.True(t, IsCorrupted(err))
+	_, err = (&LocalBackend{Dir: dir}).Read(context.Background(), "bcdef")
+	assert.True(t, IsNotFound(err), "corrupted shards are not written through")
+}
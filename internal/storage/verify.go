@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Verify checks that the dataset served by s is usable. The dataset must have a
+// manifest and shards for samples prefixes spread evenly over all prefixes must be
+// readable and not corrupted.
+//
+// Shards may be missing for some prefixes of small datasets, but at least one of
+// the sampled shards must exist so an empty data directory fails verification.
+func Verify(ctx context.Context, s Storage, samples int) error {
+	ctx = Pin(ctx, s)
+
+	m := ManifestOf(ctx, s)
+	if m.HashType == 0 {
+		// Manifests written by preprocess always record the hash type.
+		return errors.New("dataset has no manifest")
+	}
+
+	prefixes := uint64(1) << uint(4*m.PrefixLength)
+	if samples < 1 || uint64(samples) > prefixes {
+		samples = int(prefixes)
+	}
+
+	found := 0
+	for i := 0; i < samples; i++ {
+		prefix := fmt.Sprintf("%0*x", m.PrefixLength, uint64(i)*prefixes/uint64(samples))
+		shard, err := s.GetShard(ctx, prefix)
+		if IsNotFound(err) {
+			continue
+		}
+		if err == nil {
+			_, _, err = DecodeShard(shard)
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "reading shard '%s' failed", prefix)
+		}
+		found++
+	}
+
+	if found == 0 {
+		return errors.Errorf("none of %d sampled shards exist", samples)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifest := Manifest{HashType: HashTypeSHA1, PrefixLength: 2}
+	s := WithManifest(NewLocalStorage(dir, HashTypeSHA1), manifest)
+
+	err = Verify(context.Background(), NewLocalStorage(dir, HashTypeSHA1), 4)
+	assert.EqualError(t, err, "dataset has no manifest")
+
+	err = Verify(context.Background(), s, 4)
+	assert.EqualError(t, err, "none of 4 sampled shards exist")
+
+	shard, err := EncodeShard(HashTypeSHA1, []Hash{{Hash: hashOf(0x40), Count: 1}})
+	require.NoError(t, err)
+	require.NoError(t, WriteShardFile(dir, "40", shard))
+	assert.NoError(t, Verify(context.Background(), s, 4))
+	// Shards for 00, 40, 80 and c0 are sampled.
+	assert.NoError(t, Verify(context.Background(), s, 1000))
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, PathFor("80", ".bin")), shard[:len(shard)-1], 0644))
+	err = Verify(context.Background(), s, 4)
+	assert.True(t, IsCorrupted(err))
+	assert.Contains(t, err.Error(), "'80'")
+}
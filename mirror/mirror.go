@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/arjantop/pwned-passwords/client"
+	"github.com/arjantop/pwned-passwords/internal/storage"
+	"github.com/arjantop/pwned-passwords/pwnedpasswords"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+)
+
+var (
+	serverAddr  = flag.String("addr", "", "address and port of remote server")
+	useTLS      = flag.Bool("tls", false, "Connect to the server using TLS")
+	caFile      = flag.String("caFile", "", "PEM encoded CA certificates trusted to sign the server certificate (system roots if empty)")
+	certFile    = flag.String("certFile", "", "PEM encoded client certificate for servers requiring mutual TLS")
+	keyFile     = flag.String("keyFile", "", "PEM encoded private key of the client certificate")
+	serverName  = flag.String("serverName", "", "Name the server certificate is verified against (host of addr if empty)")
+	apiKey      = flag.String("apiKey", "", "API key for servers that require authentication")
+	outputDir   = flag.String("outputDir", "", "Output directory for mirrored files")
+	startPrefix = flag.String("start", "", "First prefix to mirror (defaults to the first prefix)")
+	endPrefix   = flag.String("end", "", "Last prefix to mirror (defaults to the last prefix)")
+	hashType    = flag.String("hashType", "sha1", "Hash type of the dataset to mirror (sha1 or ntlm)")
+)
+
+func protoHashType(t storage.HashType) pwnedpasswords.HashType {
+	if t == storage.HashTypeNTLM {
+		return pwnedpasswords.HashType_NTLM
+	}
+	return pwnedpasswords.HashType_SHA1
+}
+
+// writeShard validates the received shard and writes it in the layout served by storage.NewLocalStorage.
+func writeShard(shard *pwnedpasswords.Shard, expectedHashType storage.HashType) (storage.ShardHeader, error) {
+	header, _, err := storage.DecodeShard(shard.Data)
+	if err != nil {
+		return header, errors.WithMessagef(err, "invalid shard '%s'", shard.HashPrefix)
+	}
+	if header.Checksum != shard.Checksum {
+		return header, errors.Errorf("checksum of shard '%s' does not match", shard.HashPrefix)
+	}
+	if header.HashType != expectedHashType {
+		return header, errors.Errorf("shard '%s' contains %s hashes, expected %s", shard.HashPrefix, header.HashType, expectedHashType)
+	}
+
+	return header, storage.WriteShardFile(*outputDir, shard.HashPrefix, shard.Data)
+}
+
+// mirroredShards describes the shards written by the mirror.
+type mirroredShards struct {
+	count        int
+	prefixLength int
+	encoding     storage.ShardEncoding
+}
+
+func (s *mirroredShards) add(shard *pwnedpasswords.Shard, header storage.ShardHeader) error {
+	if s.count > 0 && len(shard.HashPrefix) != s.prefixLength {
+		return errors.Errorf("shard '%s' has a prefix of length %d, expected %d", shard.HashPrefix, len(shard.HashPrefix), s.prefixLength)
+	}
+	if s.count > 0 && header.Encoding() != s.encoding {
+		return errors.Errorf("shard '%s' is %s encoded, expected %s", shard.HashPrefix, header.Encoding(), s.encoding)
+	}
+	s.count++
+	s.prefixLength = len(shard.HashPrefix)
+	s.encoding = header.Encoding()
+	return nil
+}
+
+// manifestFor returns the manifest of the mirrored dataset described by the server.
+// The mirrored shards must match it so the mirror is served like the original.
+func manifestFor(info *pwnedpasswords.DatasetInfo, hashType storage.HashType, shards mirroredShards) (storage.Manifest, error) {
+	if info.HashType != protoHashType(hashType) {
+		return storage.Manifest{}, errors.Errorf("server describes %s dataset, expected %s", info.HashType, hashType)
+	}
+
+	m := storage.Manifest{
+		HashType:     hashType,
+		PrefixLength: int(info.PrefixLength),
+		Version:      info.Version,
+		ReleaseDate:  info.ReleaseDate,
+		HashCount:    info.HashCount,
+		Checksum:     info.Checksum,
+	}
+	if info.BuildTime != nil {
+		buildTime, err := ptypes.Timestamp(info.BuildTime)
+		if err != nil {
+			return storage.Manifest{}, errors.WithMessage(err, "invalid build time")
+		}
+		m.BuildTime = buildTime
+	}
+
+	switch {
+	case info.Encoding != "":
+		encoding, err := storage.ParseShardEncoding(info.Encoding)
+		if err != nil {
+			return storage.Manifest{}, err
+		}
+		m.Encoding = encoding
+	case shards.count > 0:
+		// Servers of datasets without a manifest do not know the encoding.
+		m.Encoding = shards.encoding
+	default:
+		return storage.Manifest{}, errors.New("encoding of the dataset is unknown")
+	}
+
+	if shards.count > 0 {
+		if shards.prefixLength != m.PrefixLength {
+			return storage.Manifest{}, errors.Errorf("shards have prefixes of length %d, dataset has %d", shards.prefixLength, m.PrefixLength)
+		}
+		if shards.encoding != m.Encoding {
+			return storage.Manifest{}, errors.Errorf("shards are %s encoded, dataset is %s encoded", shards.encoding, m.Encoding)
+		}
+	}
+	return m, nil
+}
+
+func main() {
+	flag.Parse()
+
+	if *serverAddr == "" || *outputDir == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	shardHashType, err := storage.ParseHashType(*hashType)
+	if err != nil {
+		log.Fatalf("Invalid hash type: %s", err)
+	}
+
+	conn, err := client.Dial(*serverAddr, client.DialOptions{
+		Insecure:   !*useTLS,
+		CAFile:     *caFile,
+		CertFile:   *certFile,
+		KeyFile:    *keyFile,
+		ServerName: *serverName,
+		APIKey:     *apiKey,
+	})
+	if err != nil {
+		log.Fatalf("Could not dial: %s", err)
+	}
+	defer conn.Close()
+
+	c := pwnedpasswords.NewPwnedPasswordsClient(conn)
+
+	r, err := c.DownloadRange(context.Background(), &pwnedpasswords.DownloadRangeRequest{
+		StartPrefix: strings.ToLower(*startPrefix),
+		EndPrefix:   strings.ToLower(*endPrefix),
+		HashType:    protoHashType(shardHashType),
+	})
+	if err != nil {
+		log.Fatalf("Download failed: %s", err)
+	}
+
+	var shards mirroredShards
+	for {
+		shard, err := r.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Download failed: %s", err)
+		}
+
+		header, err := writeShard(shard, shardHashType)
+		if err != nil {
+			log.Fatalf("Could not write shard: %s", err)
+		}
+		if err := shards.add(shard, header); err != nil {
+			log.Fatalf("Inconsistent shards: %s", err)
+		}
+	}
+
+	// The manifest records the prefix length and encoding the mirror is served with.
+	info, err := c.GetDatasetInfo(context.Background(), &pwnedpasswords.DatasetInfoRequest{HashType: protoHashType(shardHashType)})
+	if err != nil {
+		log.Fatalf("Could not get dataset info: %s", err)
+	}
+	m, err := manifestFor(info, shardHashType, shards)
+	if err != nil {
+		log.Fatalf("Mirrored dataset does not match the server: %s", err)
+	}
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		log.Fatalf("Could not create output directory: %s", err)
+	}
+	if err := storage.WriteManifest(*outputDir, m); err != nil {
+		log.Fatalf("Could not write manifest: %s", err)
+	}
+
+	log.Printf("Mirrored %d shards", shards.count)
+}
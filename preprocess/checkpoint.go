@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const checkpointFileName = "checkpoint.json"
+
+// checkpoint records the progress of preprocessing so an interrupted run can be resumed.
+type checkpoint struct {
+	// Input identifies the input file the checkpoint belongs to.
+	Input     string `json:"input"`
+	InputSize int64  `json:"inputSize"`
+	// InputOffset is the offset of the first input byte that is not yet part of a sorted run.
+	InputOffset int64 `json:"inputOffset"`
+	// Runs are names of sorted run files in workDir.
+	Runs      []string `json:"runs"`
+	SplitDone bool     `json:"splitDone"`
+	// LastPrefix is the last prefix for which all shards up to and including it were written.
+	LastPrefix string `json:"lastPrefix"`
+
+	dir string
+}
+
+// loadCheckpoint loads the checkpoint from dir. A new checkpoint is returned if none exists.
+func loadCheckpoint(dir string) (*checkpoint, error) {
+	cp := &checkpoint{dir: dir}
+
+	buf, err := ioutil.ReadFile(path.Join(dir, checkpointFileName))
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "reading checkpoint failed")
+	}
+
+	if err := json.Unmarshal(buf, cp); err != nil {
+		return nil, errors.WithMessage(err, "decoding checkpoint failed")
+	}
+
+	return cp, nil
+}
+
+// started reports whether any progress has been recorded.
+func (cp *checkpoint) started() bool {
+	return cp.InputOffset > 0 || len(cp.Runs) > 0 || cp.SplitDone
+}
+
+// save atomically replaces the checkpoint file.
+func (cp *checkpoint) save() error {
+	buf, err := json.Marshal(cp)
+	if err != nil {
+		return errors.WithMessage(err, "encoding checkpoint failed")
+	}
+
+	tmpPath := path.Join(cp.dir, checkpointFileName+".tmp")
+	if err := ioutil.WriteFile(tmpPath, buf, 0644); err != nil {
+		return errors.WithMessage(err, "writing checkpoint failed")
+	}
+
+	return errors.WithMessage(os.Rename(tmpPath, path.Join(cp.dir, checkpointFileName)), "replacing checkpoint failed")
+}
+
+// sequencer commits tasks that complete out of order in the order of their sequence numbers.
+type sequencer struct {
+	mu        sync.Mutex
+	next      int
+	completed map[int]func() error
+}
+
+func newSequencer(first int) *sequencer {
+	return &sequencer{
+		next:      first,
+		completed: make(map[int]func() error),
+	}
+}
+
+// done marks the task with the sequence number as completed. Commit functions of
+// all tasks that are now in order are called before done returns.
+func (s *sequencer) done(seq int, commit func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.completed[seq] = commit
+	for {
+		commit, ok := s.completed[s.next]
+		if !ok {
+			return nil
+		}
+		delete(s.completed, s.next)
+		s.next++
+
+		if err := commit(); err != nil {
+			return err
+		}
+	}
+}
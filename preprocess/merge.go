@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/arjantop/pwned-passwords/internal/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// checkpointInterval is the number of written shards after which the checkpoint is saved.
+const checkpointInterval = 1024
+
+// runReader reads records from a sorted run file.
+type runReader struct {
+	f        *os.File
+	r        *bufio.Reader
+	hashSize int
+	current  []byte
+}
+
+func openRun(filePath string, hashType storage.HashType) (*runReader, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "opening run failed")
+	}
+
+	return &runReader{
+		f:        f,
+		r:        bufio.NewReaderSize(f, 64*1024),
+		hashSize: hashType.Size(),
+		current:  make([]byte, hashType.RecordSize()),
+	}, nil
+}
+
+// next reads the next record into current. It returns false if the run is exhausted.
+func (r *runReader) next() (bool, error) {
+	_, err := io.ReadFull(r.r, r.current)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithMessagef(err, "reading run '%s' failed", r.f.Name())
+	}
+	return true, nil
+}
+
+func (r *runReader) hash() []byte {
+	return r.current[:r.hashSize]
+}
+
+func (r *runReader) count() uint32 {
+	return binary.BigEndian.Uint32(r.current[r.hashSize:])
+}
+
+// runHeap is a min-heap of runs ordered by their current hash.
+type runHeap []*runReader
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return bytes.Compare(h[i].hash(), h[j].hash()) < 0 }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+type shardJob struct {
+	seq    int
+	prefix string
+	hashes []storage.Hash
+}
+
+// merger merges sorted runs and writes a shard for every prefix.
+type merger struct {
+	HashType storage.HashType
+	// Encoding of written shards. Shards are encoded raw if it is not set.
+	Encoding storage.ShardEncoding
+	// PrefixLength is the number of leading hex characters of hashes used as shard keys.
+	PrefixLength int
+	Workers      int
+	WorkDir      string
+	OutputDir    string
+	// PreviousDir is an optional directory with a previous generation of the dataset.
+	// Shards that did not change are linked from it instead of being written again.
+	PreviousDir string
+	// Packed writes all shards into a single packed file in OutputDir instead of
+	// a file per shard.
+	Packed bool
+
+	// hashCount and checksum describe the merged dataset for its manifest. They
+	// are set by Merge.
+	hashCount uint64
+	checksum  string
+}
+
+// Merge merges all runs from the checkpoint. Shards for prefixes up to the last
+// prefix recorded in the checkpoint are not written again.
+//
+// A packed file is always written from the start because it is only complete
+// after all shards have been written.
+func (m *merger) Merge(cp *checkpoint) error {
+	runs := make(runHeap, 0, len(cp.Runs))
+	defer func() {
+		for _, r := range runs {
+			r.f.Close()
+		}
+	}()
+
+	for _, name := range cp.Runs {
+		r, err := openRun(path.Join(m.WorkDir, name), m.HashType)
+		if err != nil {
+			return err
+		}
+		ok, err := r.next()
+		if err != nil {
+			r.f.Close()
+			return err
+		}
+		if !ok {
+			r.f.Close()
+			continue
+		}
+		runs = append(runs, r)
+	}
+	heap.Init(&runs)
+
+	// The checkpoint is modified by workers so the prefix to resume after is read upfront.
+	resumeAfter := cp.LastPrefix
+	if resumeAfter != "" && len(resumeAfter) != m.PrefixLength {
+		return errors.Errorf("checkpoint was written with prefix length %d", len(resumeAfter))
+	}
+
+	encoding := m.Encoding
+	if encoding == 0 {
+		encoding = storage.ShardEncodingRaw
+	}
+
+	var packed *storage.PackedWriter
+	if m.Packed {
+		resumeAfter = ""
+		if err := os.MkdirAll(m.OutputDir, 0755); err != nil {
+			return errors.WithMessage(err, "creating output directory failed")
+		}
+		w, err := storage.NewPackedWriter(path.Join(m.OutputDir, storage.PackedFileName), m.PrefixLength)
+		if err != nil {
+			return errors.WithMessage(err, "creating packed file failed")
+		}
+		defer w.Abort()
+		packed = w
+	}
+
+	g, ctx := errgroup.WithContext(context.Background())
+	jobs := make(chan shardJob, m.Workers)
+	seq := newSequencer(0)
+	var sinceCheckpoint int
+
+	for i := 0; i < m.Workers; i++ {
+		g.Go(func() error {
+			for job := range jobs {
+				shard, err := storage.EncodeShardWith(encoding, m.HashType, job.hashes)
+				if err != nil {
+					return errors.WithMessagef(err, "encoding shard '%s' failed", job.prefix)
+				}
+				if packed == nil {
+					if err := m.writeShard(job.prefix, shard); err != nil {
+						return err
+					}
+				}
+
+				prefix := job.prefix
+				err = seq.done(job.seq, func() error {
+					if packed != nil {
+						// Shards are appended to the packed file in the order of their prefixes.
+						return packed.WriteShard(prefix, shard)
+					}
+					cp.LastPrefix = prefix
+					sinceCheckpoint++
+					if sinceCheckpoint < checkpointInterval {
+						return nil
+					}
+					sinceCheckpoint = 0
+					return cp.save()
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	jobSeq := 0
+	checksum := sha256.New()
+	var hashCount uint64
+	var countBuf [4]byte
+	emit := func(prefix string, hashes []storage.Hash) bool {
+		// Hashes written before the checkpoint are included so the checksum always
+		// covers the whole dataset.
+		for _, h := range hashes {
+			checksum.Write(h.Hash)
+			binary.BigEndian.PutUint32(countBuf[:], h.Count)
+			checksum.Write(countBuf[:])
+		}
+		hashCount += uint64(len(hashes))
+
+		if prefix <= resumeAfter {
+			// Already written before the checkpoint was saved.
+			return true
+		}
+		select {
+		case jobs <- shardJob{seq: jobSeq, prefix: prefix, hashes: hashes}:
+			jobSeq++
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	mergeErr := func() error {
+		var currentPrefix string
+		var hashes []storage.Hash
+
+		for runs.Len() > 0 {
+			r := runs[0]
+
+			if n := len(hashes); n > 0 && bytes.Equal(hashes[n-1].Hash, r.hash()) {
+				// The same hash appeared multiple times in the input.
+				hashes[n-1].Count = addCounts(hashes[n-1].Count, r.count())
+			} else {
+				prefix := storage.HashPrefix(r.hash(), m.PrefixLength)
+				if prefix != currentPrefix {
+					if currentPrefix != "" && !emit(currentPrefix, hashes) {
+						return nil
+					}
+					currentPrefix = prefix
+					hashes = nil
+				}
+
+				hashes = append(hashes, storage.Hash{
+					Hash:  append([]byte(nil), r.hash()...),
+					Count: r.count(),
+				})
+			}
+
+			ok, err := r.next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(&runs, 0)
+			} else {
+				heap.Pop(&runs)
+				r.f.Close()
+			}
+		}
+
+		if currentPrefix != "" {
+			emit(currentPrefix, hashes)
+		}
+		return nil
+	}()
+	close(jobs)
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if mergeErr != nil {
+		return mergeErr
+	}
+	if packed != nil {
+		if err := packed.Close(); err != nil {
+			return errors.WithMessage(err, "writing packed file failed")
+		}
+	}
+
+	m.hashCount = hashCount
+	m.checksum = hex.EncodeToString(checksum.Sum(nil))
+	return cp.save()
+}
+
+func (m *merger) writeShard(prefix string, shard []byte) error {
+	if m.PreviousDir != "" {
+		previous, err := ioutil.ReadFile(path.Join(m.PreviousDir, storage.PathFor(prefix, ".bin")))
+		if err == nil && bytes.Equal(previous, shard) {
+			return errors.WithMessagef(storage.LinkShardFile(m.PreviousDir, m.OutputDir, prefix), "linking shard '%s' failed", prefix)
+		}
+	}
+
+	return errors.WithMessagef(storage.WriteShardFile(m.OutputDir, prefix, shard), "writing shard '%s' failed", prefix)
+}
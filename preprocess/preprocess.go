@@ -1,72 +1,95 @@
 package main
 
 import (
-	"bufio"
-	"encoding/hex"
 	"flag"
-	"fmt"
 	"io"
 	"log"
 	"os"
 	"path"
-	"strings"
+	"runtime"
+	"time"
 
 	"github.com/arjantop/pwned-passwords/internal/storage"
 )
 
-var outputDir = flag.String("outputDir", "", "Output directory for pre-processed files")
+var (
+	outputDir = flag.String("outputDir", "", "Output directory for pre-processed files")
+	hashType  = flag.String("hashType", "sha1", "Hash type of the input file (sha1 or ntlm)")
+	workDir   = flag.String("workDir", "", "Directory for temporary files and the checkpoint (defaults to .preprocess in outputDir)")
+	chunkSize = flag.Int("chunkSize", 4000000, "Maximum number of hashes sorted in memory by a single worker")
+	workers   = flag.Int("workers", runtime.NumCPU(), "Number of parallel workers")
+	format    = flag.String("format", "files", "Output format (files for a file per prefix or packed for a single packed file)")
+	encoding  = flag.String("encoding", "raw", "Encoding of shards (raw or compact)")
+	prefixLen = flag.Int("prefixLength", storage.DefaultPrefixLength, "Number of leading hex characters of hashes used as shard keys")
+
+	version     = flag.String("version", "", "Version of the input corpus recorded in the manifest (for example v5)")
+	releaseDate = flag.String("releaseDate", "", "Release date of the input corpus recorded in the manifest (YYYY-MM-DD)")
+
+	generation = flag.String("generation", "", "Name of the generation to write into outputDir (files are written directly into outputDir if not set)")
+	activate   = flag.Bool("activate", true, "Make the written generation the current one")
+)
 
-type prefixWriter struct {
-	PrefixLength   int
-	PathPartLength int
-	currentPrefix  string
-	currentFile    *os.File
-}
+func main() {
+	flag.Parse()
 
-func (w *prefixWriter) WriteHash(hash string) error {
-	prefix := hash[0:5]
-	if w.currentPrefix != prefix {
-		w.currentPrefix = prefix
+	if flag.NArg() != 1 || *outputDir == "" || *chunkSize < 1 || *workers < 1 || (*format != "files" && *format != "packed") {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	inputHashType, err := storage.ParseHashType(*hashType)
+	if err != nil {
+		log.Fatalf("Invalid hash type: %s", err)
+	}
+	shardEncoding, err := storage.ParseShardEncoding(*encoding)
+	if err != nil {
+		log.Fatalf("Invalid shard encoding: %s", err)
+	}
+	manifest := storage.Manifest{
+		HashType:     inputHashType,
+		PrefixLength: *prefixLen,
+		Encoding:     shardEncoding,
+		Version:      *version,
+		ReleaseDate:  *releaseDate,
+	}
+	if err := manifest.Validate(); err != nil {
+		log.Fatalf("Invalid dataset: %s", err)
+	}
 
-		filePath := storage.PathFor(prefix, ".bin")
+	dataDir := *outputDir
+	var previousDir string
+	if *generation != "" {
+		dataDir = path.Join(*outputDir, *generation)
 
-		fullPath := path.Join(*outputDir, filePath)
-		err := os.MkdirAll(path.Dir(fullPath), 0755)
+		current, err := storage.CurrentGeneration(*outputDir)
 		if err != nil {
-			return fmt.Errorf("creating directory failed: %s", err)
+			log.Fatalf("Could not read current generation: %s", err)
 		}
-
-		f, err := os.Create(fullPath)
-		if err != nil {
-			return fmt.Errorf("creating file failed: %s", err)
+		if current != "" && current != *generation {
+			previousDir = path.Join(*outputDir, current)
+			log.Printf("Reusing unchanged shards from generation '%s'", current)
 		}
-		w.currentFile = f
 	}
 
-	h, err := hex.DecodeString(hash)
-	if err != nil {
-		return fmt.Errorf("decoding hash failed: %s", err)
+	if *workDir == "" {
+		*workDir = path.Join(dataDir, ".preprocess")
 	}
-
-	if _, err := w.currentFile.Write(h); err != nil {
-		return fmt.Errorf("writing hash failed: %s", err)
+	if err := os.MkdirAll(*workDir, 0755); err != nil {
+		log.Fatalf("Could not create work directory: %s", err)
 	}
 
-	return nil
-}
-
-func main() {
-	flag.Parse()
-
-	if flag.NArg() != 1 || *outputDir == "" {
-		flag.Usage()
-		os.Exit(1)
+	cp, err := loadCheckpoint(*workDir)
+	if err != nil {
+		log.Fatalf("Could not load checkpoint: %s", err)
 	}
 
 	fileName := flag.Arg(0)
 
 	var input io.ReadCloser
 	if fileName == "-" {
+		if cp.started() {
+			log.Fatalf("Cannot resume from standard input, remove %s to start over", *workDir)
+		}
 		input = os.Stdin
 	} else {
 		f, err := os.Open(fileName)
@@ -77,24 +100,73 @@ func main() {
 	}
 	defer input.Close()
 
-	prefixWriter := &prefixWriter{
-		PrefixLength:   5,
-		PathPartLength: 3,
-	}
-	scanner := bufio.NewScanner(input)
+	if f, ok := input.(*os.File); ok && f != os.Stdin {
+		info, err := f.Stat()
+		if err != nil {
+			log.Fatalf("Could not stat file: %s", err)
+		}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, ":")
-		if len(parts) != 2 {
-			log.Fatalf("Unexpected line: %s", line)
+		if cp.started() && (cp.Input != fileName || cp.InputSize != info.Size()) {
+			log.Fatalf("Checkpoint in %s belongs to a different input, remove it to start over", *workDir)
+		}
+		cp.Input = fileName
+		cp.InputSize = info.Size()
+
+		if cp.InputOffset > 0 {
+			log.Printf("Resuming input from offset %d", cp.InputOffset)
+			if _, err := f.Seek(cp.InputOffset, io.SeekStart); err != nil {
+				log.Fatalf("Could not seek input: %s", err)
+			}
 		}
+	}
 
-		if err := prefixWriter.WriteHash(parts[0]); err != nil {
-			log.Fatalf("Could not write line: %s", err)
+	if !cp.SplitDone {
+		s := &splitter{
+			HashType:  inputHashType,
+			ChunkSize: *chunkSize,
+			Workers:   *workers,
+			WorkDir:   *workDir,
+		}
+		if err := s.Split(input, cp); err != nil {
+			log.Fatalf("Could not sort input: %s", err)
 		}
+		log.Printf("Sorted input into %d runs", len(cp.Runs))
 	}
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("Could not read from file: %s", err)
+
+	packed := *format == "packed"
+	if cp.LastPrefix != "" && !packed {
+		log.Printf("Resuming shards after prefix %s", cp.LastPrefix)
+	}
+
+	m := &merger{
+		HashType:     inputHashType,
+		Encoding:     shardEncoding,
+		PrefixLength: *prefixLen,
+		Workers:      *workers,
+		WorkDir:      *workDir,
+		OutputDir:    dataDir,
+		PreviousDir:  previousDir,
+		Packed:       packed,
+	}
+	if err := m.Merge(cp); err != nil {
+		log.Fatalf("Could not write shards: %s", err)
+	}
+
+	manifest.HashCount = m.hashCount
+	manifest.Checksum = m.checksum
+	manifest.BuildTime = time.Now().UTC().Truncate(time.Second)
+	if err := storage.WriteManifest(dataDir, manifest); err != nil {
+		log.Fatalf("Could not write manifest: %s", err)
+	}
+
+	if err := os.RemoveAll(*workDir); err != nil {
+		log.Fatalf("Could not remove work directory: %s", err)
+	}
+
+	if *generation != "" && *activate {
+		if err := storage.SetCurrentGeneration(*outputDir, *generation); err != nil {
+			log.Fatalf("Could not activate generation: %s", err)
+		}
+		log.Printf("Generation '%s' is now current", *generation)
 	}
 }
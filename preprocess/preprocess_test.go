@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/arjantop/pwned-passwords/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testInput struct {
+	lines    []string
+	expected map[string][]storage.Hash
+}
+
+// newTestInput generates unsorted input with a duplicated hash.
+func newTestInput(n int) testInput {
+	return newTestInputWithPrefixLength(n, storage.DefaultPrefixLength)
+}
+
+func newTestInputWithPrefixLength(n int, prefixLength int) testInput {
+	in := testInput{expected: make(map[string][]storage.Hash)}
+
+	for i := n - 1; i >= 0; i-- {
+		hash := sha1.Sum([]byte(fmt.Sprintf("password%d", i)))
+		in.lines = append(in.lines, fmt.Sprintf("%X:%d\r\n", hash, i+1))
+
+		prefix := fmt.Sprintf("%x", hash)[:prefixLength]
+		count := uint32(i + 1)
+		if i == 0 {
+			// Counts of duplicated hashes are summed.
+			in.lines = append(in.lines, fmt.Sprintf("%X:%d\r\n", hash, 10))
+			count += 10
+		}
+		in.expected[prefix] = append(in.expected[prefix], storage.Hash{Hash: hash[:], Count: count})
+	}
+
+	for _, hashes := range in.expected {
+		sort.Slice(hashes, func(i, j int) bool {
+			return string(hashes[i].Hash) < string(hashes[j].Hash)
+		})
+	}
+
+	return in
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "preprocess")
+	require.NoError(t, err)
+	return dir
+}
+
+func assertShards(t *testing.T, dir string, expected map[string][]storage.Hash) {
+	s, err := storage.OpenLocalStorage(dir, storage.HashTypeSHA1)
+	require.NoError(t, err)
+	for prefix, hashes := range expected {
+		result, err := s.Get(context.Background(), prefix)
+		if assert.NoError(t, err) {
+			assert.Equal(t, hashes, result, "prefix %s", prefix)
+		}
+	}
+}
+
+func TestSplitAndMergeWriteShardsFromUnsortedInput(t *testing.T) {
+	workDir, outputDir := tempDir(t), tempDir(t)
+	defer os.RemoveAll(workDir)
+	defer os.RemoveAll(outputDir)
+
+	in := newTestInput(500)
+	cp := &checkpoint{dir: workDir}
+
+	s := &splitter{HashType: storage.HashTypeSHA1, ChunkSize: 7, Workers: 4, WorkDir: workDir}
+	require.NoError(t, s.Split(strings.NewReader(strings.Join(in.lines, "")), cp))
+	assert.True(t, cp.SplitDone)
+	assert.Len(t, cp.Runs, (len(in.lines)+6)/7)
+
+	m := &merger{HashType: storage.HashTypeSHA1, PrefixLength: storage.DefaultPrefixLength, Workers: 4, WorkDir: workDir, OutputDir: outputDir}
+	require.NoError(t, m.Merge(cp))
+
+	assertShards(t, outputDir, in.expected)
+}
+
+func TestMergeWritesCompactShards(t *testing.T) {
+	workDir, outputDir := tempDir(t), tempDir(t)
+	defer os.RemoveAll(workDir)
+	defer os.RemoveAll(outputDir)
+
+	in := newTestInput(300)
+	cp, err := loadCheckpoint(workDir)
+	require.NoError(t, err)
+
+	s := &splitter{HashType: storage.HashTypeSHA1, ChunkSize: 50, Workers: 2, WorkDir: workDir}
+	require.NoError(t, s.Split(strings.NewReader(strings.Join(in.lines, "")), cp))
+
+	m := &merger{HashType: storage.HashTypeSHA1, PrefixLength: storage.DefaultPrefixLength, Encoding: storage.ShardEncodingCompact, Workers: 2, WorkDir: workDir, OutputDir: outputDir}
+	require.NoError(t, m.Merge(cp))
+
+	for prefix := range in.expected {
+		buf, err := ioutil.ReadFile(path.Join(outputDir, storage.PathFor(prefix, ".bin")))
+		require.NoError(t, err)
+		header, err := storage.DecodeShardHeader(buf)
+		require.NoError(t, err)
+		assert.Equal(t, storage.ShardEncodingCompact, header.Encoding())
+	}
+	assertShards(t, outputDir, in.expected)
+}
+
+func TestMergeWritesShardsWithConfiguredPrefixLength(t *testing.T) {
+	for _, prefixLength := range []int{3, 6} {
+		workDir, outputDir := tempDir(t), tempDir(t)
+		defer os.RemoveAll(workDir)
+		defer os.RemoveAll(outputDir)
+
+		in := newTestInputWithPrefixLength(100, prefixLength)
+		cp, err := loadCheckpoint(workDir)
+		require.NoError(t, err)
+
+		s := &splitter{HashType: storage.HashTypeSHA1, ChunkSize: 30, Workers: 2, WorkDir: workDir}
+		require.NoError(t, s.Split(strings.NewReader(strings.Join(in.lines, "")), cp))
+
+		m := &merger{HashType: storage.HashTypeSHA1, PrefixLength: prefixLength, Workers: 2, WorkDir: workDir, OutputDir: outputDir}
+		require.NoError(t, m.Merge(cp))
+
+		for prefix := range in.expected {
+			assert.Len(t, prefix, prefixLength)
+		}
+		assertShards(t, outputDir, in.expected)
+	}
+}
+
+func TestMergeFailsToResumeWithDifferentPrefixLength(t *testing.T) {
+	workDir, outputDir := tempDir(t), tempDir(t)
+	defer os.RemoveAll(workDir)
+	defer os.RemoveAll(outputDir)
+
+	cp, err := loadCheckpoint(workDir)
+	require.NoError(t, err)
+	cp.SplitDone = true
+	cp.LastPrefix = "abcde"
+
+	m := &merger{HashType: storage.HashTypeSHA1, PrefixLength: 4, Workers: 1, WorkDir: workDir, OutputDir: outputDir}
+	assert.Error(t, m.Merge(cp))
+}
+
+func TestMergeWritesPackedFileEvenAfterCheckpointedPrefix(t *testing.T) {
+	workDir, outputDir := tempDir(t), tempDir(t)
+	defer os.RemoveAll(workDir)
+	defer os.RemoveAll(outputDir)
+
+	in := newTestInput(200)
+	cp, err := loadCheckpoint(workDir)
+	require.NoError(t, err)
+
+	s := &splitter{HashType: storage.HashTypeSHA1, ChunkSize: 30, Workers: 2, WorkDir: workDir}
+	require.NoError(t, s.Split(strings.NewReader(strings.Join(in.lines, "")), cp))
+	cp.LastPrefix = "80000"
+
+	m := &merger{HashType: storage.HashTypeSHA1, PrefixLength: storage.DefaultPrefixLength, Workers: 3, WorkDir: workDir, OutputDir: outputDir, Packed: true}
+	require.NoError(t, m.Merge(cp))
+
+	files, err := ioutil.ReadDir(outputDir)
+	require.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, storage.PackedFileName, files[0].Name())
+	}
+	assertShards(t, outputDir, in.expected)
+}
+
+func TestSplitResumesFromCheckpoint(t *testing.T) {
+	workDir, outputDir := tempDir(t), tempDir(t)
+	defer os.RemoveAll(workDir)
+	defer os.RemoveAll(outputDir)
+
+	in := newTestInput(100)
+	firstPart := strings.Join(in.lines[:40], "")
+	s := &splitter{HashType: storage.HashTypeSHA1, ChunkSize: 10, Workers: 2, WorkDir: workDir}
+
+	cp := &checkpoint{dir: workDir}
+	require.NoError(t, s.Split(strings.NewReader(firstPart), cp))
+
+	// Simulate a crash after the first part of the input has been processed.
+	cp, err := loadCheckpoint(workDir)
+	require.NoError(t, err)
+	cp.SplitDone = false
+	assert.Equal(t, int64(len(firstPart)), cp.InputOffset)
+
+	input := strings.NewReader(strings.Join(in.lines, ""))
+	_, err = input.Seek(cp.InputOffset, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Split(input, cp))
+
+	m := &merger{HashType: storage.HashTypeSHA1, PrefixLength: storage.DefaultPrefixLength, Workers: 2, WorkDir: workDir, OutputDir: outputDir}
+	require.NoError(t, m.Merge(cp))
+
+	assertShards(t, outputDir, in.expected)
+}
+
+func TestMergeSkipsShardsBeforeCheckpointedPrefix(t *testing.T) {
+	workDir, outputDir := tempDir(t), tempDir(t)
+	defer os.RemoveAll(workDir)
+	defer os.RemoveAll(outputDir)
+
+	in := newTestInput(50)
+	cp := &checkpoint{dir: workDir}
+
+	s := &splitter{HashType: storage.HashTypeSHA1, ChunkSize: 100, Workers: 1, WorkDir: workDir}
+	require.NoError(t, s.Split(strings.NewReader(strings.Join(in.lines, "")), cp))
+
+	var prefixes []string
+	for prefix := range in.expected {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	cp.LastPrefix = prefixes[len(prefixes)/2]
+
+	m := &merger{HashType: storage.HashTypeSHA1, PrefixLength: storage.DefaultPrefixLength, Workers: 3, WorkDir: workDir, OutputDir: outputDir}
+	require.NoError(t, m.Merge(cp))
+
+	for _, prefix := range prefixes {
+		_, err := os.Stat(path.Join(outputDir, storage.PathFor(prefix, ".bin")))
+		if prefix <= prefixes[len(prefixes)/2] {
+			assert.True(t, os.IsNotExist(err), "prefix %s", prefix)
+		} else {
+			assert.NoError(t, err, "prefix %s", prefix)
+		}
+	}
+	assert.Equal(t, prefixes[len(prefixes)-1], cp.LastPrefix)
+}
+
+func TestParseLineFailsOnInvalidInput(t *testing.T) {
+	tests := []string{
+		"abc",
+		"zz:1",
+		"0000000000000000000000000000000000000000:x",
+		"00000000000000000000000000000000:1",
+	}
+	for _, line := range tests {
+		_, err := parseLine(line, storage.HashTypeSHA1)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestMergeLinksUnchangedShardsFromPreviousGeneration(t *testing.T) {
+	workDir, outputDir := tempDir(t), tempDir(t)
+	defer os.RemoveAll(workDir)
+	defer os.RemoveAll(outputDir)
+
+	in := newTestInput(20)
+	previousDir, currentDir := path.Join(outputDir, "v1"), path.Join(outputDir, "v2")
+
+	for _, dir := range []string{previousDir, currentDir} {
+		cp := &checkpoint{dir: workDir}
+		s := &splitter{HashType: storage.HashTypeSHA1, ChunkSize: 100, Workers: 1, WorkDir: workDir}
+		require.NoError(t, s.Split(strings.NewReader(strings.Join(in.lines, "")), cp))
+
+		m := &merger{HashType: storage.HashTypeSHA1, PrefixLength: storage.DefaultPrefixLength, Workers: 2, WorkDir: workDir, OutputDir: dir}
+		if dir == currentDir {
+			m.PreviousDir = previousDir
+		}
+		require.NoError(t, m.Merge(cp))
+	}
+
+	for prefix := range in.expected {
+		previous, err := os.Stat(path.Join(previousDir, storage.PathFor(prefix, ".bin")))
+		require.NoError(t, err)
+		current, err := os.Stat(path.Join(currentDir, storage.PathFor(prefix, ".bin")))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(previous, current), "prefix %s", prefix)
+	}
+	assertShards(t, currentDir, in.expected)
+}
+
+func TestMergeChecksumDependsOnlyOnContents(t *testing.T) {
+	in := newTestInput(200)
+
+	expected := sha256.New()
+	var prefixes []string
+	for prefix := range in.expected {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		for _, h := range in.expected[prefix] {
+			expected.Write(h.Hash)
+			binary.Write(expected, binary.BigEndian, h.Count)
+		}
+	}
+
+	for _, m := range []*merger{
+		{PrefixLength: storage.DefaultPrefixLength, Workers: 2},
+		{PrefixLength: 3, Encoding: storage.ShardEncodingCompact, Workers: 3},
+		{PrefixLength: storage.DefaultPrefixLength, Packed: true, Workers: 1},
+	} {
+		workDir, outputDir := tempDir(t), tempDir(t)
+		defer os.RemoveAll(workDir)
+		defer os.RemoveAll(outputDir)
+
+		cp := &checkpoint{dir: workDir}
+		s := &splitter{HashType: storage.HashTypeSHA1, ChunkSize: 40, Workers: 2, WorkDir: workDir}
+		require.NoError(t, s.Split(strings.NewReader(strings.Join(in.lines, "")), cp))
+		// Hashes of shards written before the checkpoint are still counted.
+		cp.LastPrefix = "8" + strings.Repeat("0", m.PrefixLength-1)
+
+		m.HashType, m.WorkDir, m.OutputDir = storage.HashTypeSHA1, workDir, outputDir
+		require.NoError(t, m.Merge(cp))
+
+		assert.Equal(t, uint64(200), m.hashCount)
+		assert.Equal(t, hex.EncodeToString(expected.Sum(nil)), m.checksum)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arjantop/pwned-passwords/internal/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// parseLine parses a line in the HASH:COUNT format.
+func parseLine(line string, hashType storage.HashType) (storage.Hash, error) {
+	parts := strings.Split(strings.TrimSpace(line), ":")
+	if len(parts) != 2 {
+		return storage.Hash{}, fmt.Errorf("unexpected line '%s'", line)
+	}
+
+	h, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return storage.Hash{}, fmt.Errorf("decoding hash failed: %s", err)
+	}
+	if len(h) != hashType.Size() {
+		return storage.Hash{}, fmt.Errorf("hash '%s' is not a valid %s hash", parts[0], hashType)
+	}
+
+	count, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return storage.Hash{}, fmt.Errorf("invalid count on line '%s': %s", line, err)
+	}
+
+	return storage.Hash{Hash: h, Count: uint32(count)}, nil
+}
+
+// recordChunk is a buffer of encoded records that sorts by hash.
+type recordChunk struct {
+	buf        []byte
+	hashSize   int
+	recordSize int
+	tmp        []byte
+}
+
+func newRecordChunk(hashType storage.HashType, size int) *recordChunk {
+	return &recordChunk{
+		buf:        make([]byte, 0, size*hashType.RecordSize()),
+		hashSize:   hashType.Size(),
+		recordSize: hashType.RecordSize(),
+		tmp:        make([]byte, hashType.RecordSize()),
+	}
+}
+
+func (c *recordChunk) full() bool {
+	return len(c.buf)+c.recordSize > cap(c.buf)
+}
+
+func (c *recordChunk) record(i int) []byte {
+	return c.buf[i*c.recordSize : (i+1)*c.recordSize]
+}
+
+func (c *recordChunk) Len() int {
+	return len(c.buf) / c.recordSize
+}
+
+func (c *recordChunk) Less(i, j int) bool {
+	return bytes.Compare(c.record(i)[:c.hashSize], c.record(j)[:c.hashSize]) < 0
+}
+
+func (c *recordChunk) Swap(i, j int) {
+	copy(c.tmp, c.record(i))
+	copy(c.record(i), c.record(j))
+	copy(c.record(j), c.tmp)
+}
+
+// writeRun writes the records to a new run file in dir and returns its name.
+func (c *recordChunk) writeRun(dir string, seq int) (string, error) {
+	name := fmt.Sprintf("run-%06d.bin", seq)
+
+	tmpPath := path.Join(dir, name+".tmp")
+	if err := writeFileSynced(tmpPath, c.buf); err != nil {
+		return "", err
+	}
+
+	return name, errors.WithMessage(os.Rename(tmpPath, path.Join(dir, name)), "renaming run failed")
+}
+
+func writeFileSynced(filePath string, buf []byte) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return errors.WithMessage(err, "creating file failed")
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return errors.WithMessage(err, "writing file failed")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.WithMessage(err, "syncing file failed")
+	}
+	return errors.WithMessage(f.Close(), "closing file failed")
+}
+
+// splitter reads unsorted input and splits it into sorted runs of bounded size.
+type splitter struct {
+	HashType  storage.HashType
+	ChunkSize int
+	Workers   int
+	WorkDir   string
+}
+
+// Split reads input starting at the offset recorded in the checkpoint and writes sorted runs.
+// The checkpoint is updated each time a contiguous part of the input has been written to runs.
+func (s *splitter) Split(input io.Reader, cp *checkpoint) error {
+	g, ctx := errgroup.WithContext(context.Background())
+	// Limits the number of chunks held in memory besides the one being filled.
+	sem := make(chan struct{}, s.Workers)
+	seq := newSequencer(len(cp.Runs))
+
+	dispatch := func(chunk *recordChunk, runSeq int, endOffset int64) {
+		sem <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-sem }()
+
+			sort.Sort(chunk)
+			name, err := chunk.writeRun(s.WorkDir, runSeq)
+			if err != nil {
+				return err
+			}
+
+			return seq.done(runSeq, func() error {
+				cp.Runs = append(cp.Runs, name)
+				cp.InputOffset = endOffset
+				return cp.save()
+			})
+		})
+	}
+
+	r := bufio.NewReaderSize(input, 1<<20)
+	offset := cp.InputOffset
+	runSeq := len(cp.Runs)
+	chunk := newRecordChunk(s.HashType, s.ChunkSize)
+
+	for {
+		if ctx.Err() != nil {
+			// One of the workers failed, its error is returned by Wait.
+			return g.Wait()
+		}
+
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			g.Wait()
+			return errors.WithMessage(err, "reading input failed")
+		}
+		offset += int64(len(line))
+
+		if strings.TrimSpace(line) != "" {
+			h, parseErr := parseLine(line, s.HashType)
+			if parseErr != nil {
+				g.Wait()
+				return parseErr
+			}
+			chunk.buf = storage.AppendRecord(chunk.buf, h)
+		}
+
+		if chunk.full() || (err == io.EOF && chunk.Len() > 0) {
+			dispatch(chunk, runSeq, offset)
+			runSeq++
+			chunk = newRecordChunk(s.HashType, s.ChunkSize)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	cp.SplitDone = true
+	return cp.save()
+}
+
+// addCounts adds two counts without overflowing.
+func addCounts(a, b uint32) uint32 {
+	if a > math.MaxUint32-b {
+		return math.MaxUint32
+	}
+	return a + b
+}
@@ -7,6 +7,7 @@ import (
 	context "context"
 	fmt "fmt"
 	proto "github.com/golang/protobuf/proto"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
 	_ "google.golang.org/genproto/googleapis/api/annotations"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
@@ -25,8 +26,37 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type HashType int32
+
+const (
+	HashType_SHA1 HashType = 0
+	HashType_NTLM HashType = 1
+)
+
+var HashType_name = map[int32]string{
+	0: "SHA1",
+	1: "NTLM",
+}
+
+var HashType_value = map[string]int32{
+	"SHA1": 0,
+	"NTLM": 1,
+}
+
+func (x HashType) String() string {
+	return proto.EnumName(HashType_name, int32(x))
+}
+
+func (HashType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_645ba4fd1df226f8, []int{0}
+}
+
 type ListRequest struct {
-	HashPrefix           string   `protobuf:"bytes,1,opt,name=hashPrefix,proto3" json:"hashPrefix,omitempty"`
+	HashPrefix string   `protobuf:"bytes,1,opt,name=hashPrefix,proto3" json:"hashPrefix,omitempty"`
+	HashType   HashType `protobuf:"varint,2,opt,name=hashType,proto3,enum=pwnedpasswords.HashType" json:"hashType,omitempty"`
+	// Pad the response with decoy hashes so its size does not reveal the prefix.
+	// Over HTTP padding can also be requested with the Add-Padding: true header.
+	AddPadding           bool     `protobuf:"varint,3,opt,name=addPadding,proto3" json:"addPadding,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -64,8 +94,26 @@ func (m *ListRequest) GetHashPrefix() string {
 	return ""
 }
 
+func (m *ListRequest) GetHashType() HashType {
+	if m != nil {
+		return m.HashType
+	}
+	return HashType_SHA1
+}
+
+func (m *ListRequest) GetAddPadding() bool {
+	if m != nil {
+		return m.AddPadding
+	}
+	return false
+}
+
 type PasswordHash struct {
-	Hash                 []byte   `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	Hash []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	// Number of times the hash has been seen in breaches.
+	Count uint32 `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	// Set for decoy hashes added by padding. They must be ignored by clients.
+	Padding              bool     `protobuf:"varint,3,opt,name=padding,proto3" json:"padding,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -103,29 +151,548 @@ func (m *PasswordHash) GetHash() []byte {
 	return nil
 }
 
+func (m *PasswordHash) GetCount() uint32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *PasswordHash) GetPadding() bool {
+	if m != nil {
+		return m.Padding
+	}
+	return false
+}
+
+type CheckPrefixesRequest struct {
+	// Identifier chosen by the client, returned with the matching response.
+	RequestId  uint64   `protobuf:"varint,1,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	HashPrefix string   `protobuf:"bytes,2,opt,name=hashPrefix,proto3" json:"hashPrefix,omitempty"`
+	HashType   HashType `protobuf:"varint,3,opt,name=hashType,proto3,enum=pwnedpasswords.HashType" json:"hashType,omitempty"`
+	// Pad the response with decoy hashes so its size does not reveal the prefix.
+	AddPadding           bool     `protobuf:"varint,4,opt,name=addPadding,proto3" json:"addPadding,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CheckPrefixesRequest) Reset()         { *m = CheckPrefixesRequest{} }
+func (m *CheckPrefixesRequest) String() string { return proto.CompactTextString(m) }
+func (*CheckPrefixesRequest) ProtoMessage()    {}
+func (*CheckPrefixesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_645ba4fd1df226f8, []int{2}
+}
+
+func (m *CheckPrefixesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CheckPrefixesRequest.Unmarshal(m, b)
+}
+func (m *CheckPrefixesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CheckPrefixesRequest.Marshal(b, m, deterministic)
+}
+func (m *CheckPrefixesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CheckPrefixesRequest.Merge(m, src)
+}
+func (m *CheckPrefixesRequest) XXX_Size() int {
+	return xxx_messageInfo_CheckPrefixesRequest.Size(m)
+}
+func (m *CheckPrefixesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CheckPrefixesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CheckPrefixesRequest proto.InternalMessageInfo
+
+func (m *CheckPrefixesRequest) GetRequestId() uint64 {
+	if m != nil {
+		return m.RequestId
+	}
+	return 0
+}
+
+func (m *CheckPrefixesRequest) GetHashPrefix() string {
+	if m != nil {
+		return m.HashPrefix
+	}
+	return ""
+}
+
+func (m *CheckPrefixesRequest) GetHashType() HashType {
+	if m != nil {
+		return m.HashType
+	}
+	return HashType_SHA1
+}
+
+func (m *CheckPrefixesRequest) GetAddPadding() bool {
+	if m != nil {
+		return m.AddPadding
+	}
+	return false
+}
+
+type CheckPrefixesResponse struct {
+	RequestId            uint64          `protobuf:"varint,1,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	Hashes               []*PasswordHash `protobuf:"bytes,2,rep,name=hashes,proto3" json:"hashes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *CheckPrefixesResponse) Reset()         { *m = CheckPrefixesResponse{} }
+func (m *CheckPrefixesResponse) String() string { return proto.CompactTextString(m) }
+func (*CheckPrefixesResponse) ProtoMessage()    {}
+func (*CheckPrefixesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_645ba4fd1df226f8, []int{3}
+}
+
+func (m *CheckPrefixesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CheckPrefixesResponse.Unmarshal(m, b)
+}
+func (m *CheckPrefixesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CheckPrefixesResponse.Marshal(b, m, deterministic)
+}
+func (m *CheckPrefixesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CheckPrefixesResponse.Merge(m, src)
+}
+func (m *CheckPrefixesResponse) XXX_Size() int {
+	return xxx_messageInfo_CheckPrefixesResponse.Size(m)
+}
+func (m *CheckPrefixesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CheckPrefixesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CheckPrefixesResponse proto.InternalMessageInfo
+
+func (m *CheckPrefixesResponse) GetRequestId() uint64 {
+	if m != nil {
+		return m.RequestId
+	}
+	return 0
+}
+
+func (m *CheckPrefixesResponse) GetHashes() []*PasswordHash {
+	if m != nil {
+		return m.Hashes
+	}
+	return nil
+}
+
+type DownloadRangeRequest struct {
+	// First prefix of the range, inclusive.
+	StartPrefix string `protobuf:"bytes,1,opt,name=startPrefix,proto3" json:"startPrefix,omitempty"`
+	// Last prefix of the range, inclusive.
+	EndPrefix            string   `protobuf:"bytes,2,opt,name=endPrefix,proto3" json:"endPrefix,omitempty"`
+	HashType             HashType `protobuf:"varint,3,opt,name=hashType,proto3,enum=pwnedpasswords.HashType" json:"hashType,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DownloadRangeRequest) Reset()         { *m = DownloadRangeRequest{} }
+func (m *DownloadRangeRequest) String() string { return proto.CompactTextString(m) }
+func (*DownloadRangeRequest) ProtoMessage()    {}
+func (*DownloadRangeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_645ba4fd1df226f8, []int{4}
+}
+
+func (m *DownloadRangeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DownloadRangeRequest.Unmarshal(m, b)
+}
+func (m *DownloadRangeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DownloadRangeRequest.Marshal(b, m, deterministic)
+}
+func (m *DownloadRangeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DownloadRangeRequest.Merge(m, src)
+}
+func (m *DownloadRangeRequest) XXX_Size() int {
+	return xxx_messageInfo_DownloadRangeRequest.Size(m)
+}
+func (m *DownloadRangeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DownloadRangeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DownloadRangeRequest proto.InternalMessageInfo
+
+func (m *DownloadRangeRequest) GetStartPrefix() string {
+	if m != nil {
+		return m.StartPrefix
+	}
+	return ""
+}
+
+func (m *DownloadRangeRequest) GetEndPrefix() string {
+	if m != nil {
+		return m.EndPrefix
+	}
+	return ""
+}
+
+func (m *DownloadRangeRequest) GetHashType() HashType {
+	if m != nil {
+		return m.HashType
+	}
+	return HashType_SHA1
+}
+
+type Shard struct {
+	HashPrefix string `protobuf:"bytes,1,opt,name=hashPrefix,proto3" json:"hashPrefix,omitempty"`
+	// Encoded shard including its header.
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	// CRC-32 (Castagnoli) checksum of the shard body as stored in the shard header.
+	Checksum             uint32   `protobuf:"varint,3,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Shard) Reset()         { *m = Shard{} }
+func (m *Shard) String() string { return proto.CompactTextString(m) }
+func (*Shard) ProtoMessage()    {}
+func (*Shard) Descriptor() ([]byte, []int) {
+	return fileDescriptor_645ba4fd1df226f8, []int{5}
+}
+
+func (m *Shard) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Shard.Unmarshal(m, b)
+}
+func (m *Shard) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Shard.Marshal(b, m, deterministic)
+}
+func (m *Shard) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Shard.Merge(m, src)
+}
+func (m *Shard) XXX_Size() int {
+	return xxx_messageInfo_Shard.Size(m)
+}
+func (m *Shard) XXX_DiscardUnknown() {
+	xxx_messageInfo_Shard.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Shard proto.InternalMessageInfo
+
+func (m *Shard) GetHashPrefix() string {
+	if m != nil {
+		return m.HashPrefix
+	}
+	return ""
+}
+
+func (m *Shard) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Shard) GetChecksum() uint32 {
+	if m != nil {
+		return m.Checksum
+	}
+	return 0
+}
+
+type CheckHashRequest struct {
+	// Full hash of the password.
+	Hash                 []byte   `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	HashType             HashType `protobuf:"varint,2,opt,name=hashType,proto3,enum=pwnedpasswords.HashType" json:"hashType,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CheckHashRequest) Reset()         { *m = CheckHashRequest{} }
+func (m *CheckHashRequest) String() string { return proto.CompactTextString(m) }
+func (*CheckHashRequest) ProtoMessage()    {}
+func (*CheckHashRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_645ba4fd1df226f8, []int{6}
+}
+
+func (m *CheckHashRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CheckHashRequest.Unmarshal(m, b)
+}
+func (m *CheckHashRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CheckHashRequest.Marshal(b, m, deterministic)
+}
+func (m *CheckHashRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CheckHashRequest.Merge(m, src)
+}
+func (m *CheckHashRequest) XXX_Size() int {
+	return xxx_messageInfo_CheckHashRequest.Size(m)
+}
+func (m *CheckHashRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CheckHashRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CheckHashRequest proto.InternalMessageInfo
+
+func (m *CheckHashRequest) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *CheckHashRequest) GetHashType() HashType {
+	if m != nil {
+		return m.HashType
+	}
+	return HashType_SHA1
+}
+
+type CheckHashResponse struct {
+	Found bool `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+	// Number of times the hash has been seen in breaches.
+	Count                uint32   `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CheckHashResponse) Reset()         { *m = CheckHashResponse{} }
+func (m *CheckHashResponse) String() string { return proto.CompactTextString(m) }
+func (*CheckHashResponse) ProtoMessage()    {}
+func (*CheckHashResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_645ba4fd1df226f8, []int{7}
+}
+
+func (m *CheckHashResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CheckHashResponse.Unmarshal(m, b)
+}
+func (m *CheckHashResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CheckHashResponse.Marshal(b, m, deterministic)
+}
+func (m *CheckHashResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CheckHashResponse.Merge(m, src)
+}
+func (m *CheckHashResponse) XXX_Size() int {
+	return xxx_messageInfo_CheckHashResponse.Size(m)
+}
+func (m *CheckHashResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CheckHashResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CheckHashResponse proto.InternalMessageInfo
+
+func (m *CheckHashResponse) GetFound() bool {
+	if m != nil {
+		return m.Found
+	}
+	return false
+}
+
+func (m *CheckHashResponse) GetCount() uint32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+type DatasetInfoRequest struct {
+	HashType             HashType `protobuf:"varint,1,opt,name=hashType,proto3,enum=pwnedpasswords.HashType" json:"hashType,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DatasetInfoRequest) Reset()         { *m = DatasetInfoRequest{} }
+func (m *DatasetInfoRequest) String() string { return proto.CompactTextString(m) }
+func (*DatasetInfoRequest) ProtoMessage()    {}
+func (*DatasetInfoRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_645ba4fd1df226f8, []int{8}
+}
+
+func (m *DatasetInfoRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DatasetInfoRequest.Unmarshal(m, b)
+}
+func (m *DatasetInfoRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DatasetInfoRequest.Marshal(b, m, deterministic)
+}
+func (m *DatasetInfoRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DatasetInfoRequest.Merge(m, src)
+}
+func (m *DatasetInfoRequest) XXX_Size() int {
+	return xxx_messageInfo_DatasetInfoRequest.Size(m)
+}
+func (m *DatasetInfoRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DatasetInfoRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DatasetInfoRequest proto.InternalMessageInfo
+
+func (m *DatasetInfoRequest) GetHashType() HashType {
+	if m != nil {
+		return m.HashType
+	}
+	return HashType_SHA1
+}
+
+type DatasetInfo struct {
+	// Version of the source corpus, for example "v5". Empty if unknown.
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	// Release date of the source corpus in the YYYY-MM-DD format. Empty if unknown.
+	ReleaseDate string   `protobuf:"bytes,2,opt,name=releaseDate,proto3" json:"releaseDate,omitempty"`
+	HashType    HashType `protobuf:"varint,3,opt,name=hashType,proto3,enum=pwnedpasswords.HashType" json:"hashType,omitempty"`
+	// Number of hex characters of the hash expected in hashPrefix.
+	PrefixLength uint32 `protobuf:"varint,4,opt,name=prefixLength,proto3" json:"prefixLength,omitempty"`
+	// Number of distinct hashes in the dataset.
+	HashCount uint64 `protobuf:"varint,5,opt,name=hashCount,proto3" json:"hashCount,omitempty"`
+	// Time preprocessing of the dataset finished. Not set if unknown.
+	BuildTime *timestamp.Timestamp `protobuf:"bytes,6,opt,name=buildTime,proto3" json:"buildTime,omitempty"`
+	// Hex encoded SHA-256 of all hashes and their counts in hash order. Replicas
+	// serving the same data report the same checksum.
+	Checksum string `protobuf:"bytes,7,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	// Encoding of the shards, "raw" or "compact". Empty if unknown.
+	Encoding             string   `protobuf:"bytes,8,opt,name=encoding,proto3" json:"encoding,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DatasetInfo) Reset()         { *m = DatasetInfo{} }
+func (m *DatasetInfo) String() string { return proto.CompactTextString(m) }
+func (*DatasetInfo) ProtoMessage()    {}
+func (*DatasetInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_645ba4fd1df226f8, []int{9}
+}
+
+func (m *DatasetInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DatasetInfo.Unmarshal(m, b)
+}
+func (m *DatasetInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DatasetInfo.Marshal(b, m, deterministic)
+}
+func (m *DatasetInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DatasetInfo.Merge(m, src)
+}
+func (m *DatasetInfo) XXX_Size() int {
+	return xxx_messageInfo_DatasetInfo.Size(m)
+}
+func (m *DatasetInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_DatasetInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DatasetInfo proto.InternalMessageInfo
+
+func (m *DatasetInfo) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *DatasetInfo) GetReleaseDate() string {
+	if m != nil {
+		return m.ReleaseDate
+	}
+	return ""
+}
+
+func (m *DatasetInfo) GetHashType() HashType {
+	if m != nil {
+		return m.HashType
+	}
+	return HashType_SHA1
+}
+
+func (m *DatasetInfo) GetPrefixLength() uint32 {
+	if m != nil {
+		return m.PrefixLength
+	}
+	return 0
+}
+
+func (m *DatasetInfo) GetHashCount() uint64 {
+	if m != nil {
+		return m.HashCount
+	}
+	return 0
+}
+
+func (m *DatasetInfo) GetBuildTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.BuildTime
+	}
+	return nil
+}
+
+func (m *DatasetInfo) GetChecksum() string {
+	if m != nil {
+		return m.Checksum
+	}
+	return ""
+}
+
+func (m *DatasetInfo) GetEncoding() string {
+	if m != nil {
+		return m.Encoding
+	}
+	return ""
+}
+
 func init() {
+	proto.RegisterEnum("pwnedpasswords.HashType", HashType_name, HashType_value)
 	proto.RegisterType((*ListRequest)(nil), "pwnedpasswords.ListRequest")
 	proto.RegisterType((*PasswordHash)(nil), "pwnedpasswords.PasswordHash")
+	proto.RegisterType((*CheckPrefixesRequest)(nil), "pwnedpasswords.CheckPrefixesRequest")
+	proto.RegisterType((*CheckPrefixesResponse)(nil), "pwnedpasswords.CheckPrefixesResponse")
+	proto.RegisterType((*DownloadRangeRequest)(nil), "pwnedpasswords.DownloadRangeRequest")
+	proto.RegisterType((*Shard)(nil), "pwnedpasswords.Shard")
+	proto.RegisterType((*CheckHashRequest)(nil), "pwnedpasswords.CheckHashRequest")
+	proto.RegisterType((*CheckHashResponse)(nil), "pwnedpasswords.CheckHashResponse")
+	proto.RegisterType((*DatasetInfoRequest)(nil), "pwnedpasswords.DatasetInfoRequest")
+	proto.RegisterType((*DatasetInfo)(nil), "pwnedpasswords.DatasetInfo")
 }
 
 func init() { proto.RegisterFile("pwned_passwords.proto", fileDescriptor_645ba4fd1df226f8) }
 
 var fileDescriptor_645ba4fd1df226f8 = []byte{
-	// 215 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x2d, 0x28, 0xcf, 0x4b,
-	0x4d, 0x89, 0x2f, 0x48, 0x2c, 0x2e, 0x2e, 0xcf, 0x2f, 0x4a, 0x29, 0xd6, 0x2b, 0x28, 0xca, 0x2f,
-	0xc9, 0x17, 0xe2, 0x03, 0x0b, 0xc3, 0x45, 0xa5, 0x64, 0xd2, 0xf3, 0xf3, 0xd3, 0x73, 0x52, 0xf5,
-	0x13, 0x0b, 0x32, 0xf5, 0x13, 0xf3, 0xf2, 0xf2, 0x4b, 0x12, 0x4b, 0x32, 0xf3, 0xf3, 0xa0, 0xaa,
-	0x95, 0x74, 0xb9, 0xb8, 0x7d, 0x32, 0x8b, 0x4b, 0x82, 0x52, 0x0b, 0x4b, 0x53, 0x8b, 0x4b, 0x84,
-	0xe4, 0xb8, 0xb8, 0x32, 0x12, 0x8b, 0x33, 0x02, 0x8a, 0x52, 0xd3, 0x32, 0x2b, 0x24, 0x18, 0x15,
-	0x18, 0x35, 0x38, 0x83, 0x90, 0x44, 0x94, 0x94, 0xb8, 0x78, 0x02, 0xa0, 0x26, 0x7b, 0x24, 0x16,
-	0x67, 0x08, 0x09, 0x71, 0xb1, 0x80, 0x64, 0xc1, 0x2a, 0x79, 0x82, 0xc0, 0x6c, 0xa3, 0x2e, 0x46,
-	0x2e, 0xbe, 0x00, 0x90, 0x1b, 0x60, 0x2a, 0x8b, 0x85, 0x2a, 0xb8, 0x84, 0x41, 0xb6, 0x80, 0xb4,
-	0xa4, 0x16, 0xbb, 0xe5, 0x17, 0x41, 0x4c, 0x13, 0x92, 0xd6, 0x43, 0x75, 0xab, 0x1e, 0x92, 0x53,
-	0xa4, 0x64, 0xd0, 0x25, 0x91, 0x2d, 0x56, 0x52, 0x69, 0xba, 0xfc, 0x64, 0x32, 0x93, 0x9c, 0x90,
-	0x8c, 0x7e, 0x99, 0xa1, 0x7e, 0x06, 0xd8, 0x5c, 0xfd, 0x6a, 0x84, 0x43, 0x6b, 0xf5, 0x73, 0x32,
-	0x8b, 0x4b, 0x0c, 0x18, 0x93, 0xd8, 0xc0, 0xde, 0x34, 0x06, 0x04, 0x00, 0x00, 0xff, 0xff, 0x7f,
-	0x32, 0x31, 0xee, 0x2d, 0x01, 0x00, 0x00,
+	// 735 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0xcd, 0x6e, 0x13, 0x31,
+	0x10, 0x66, 0xf3, 0xd3, 0x6e, 0x26, 0x3f, 0x0a, 0x26, 0x45, 0xd1, 0x36, 0x2a, 0x61, 0x55, 0xa4,
+	0x88, 0x43, 0xd2, 0x86, 0x1e, 0xb8, 0x21, 0xd4, 0x0a, 0x5a, 0x54, 0xaa, 0xc8, 0x8d, 0xc4, 0x05,
+	0x09, 0xdc, 0xac, 0x93, 0x2c, 0x4d, 0xec, 0x65, 0xed, 0xb4, 0x45, 0x88, 0x0b, 0x5c, 0xb9, 0xf1,
+	0x04, 0x5c, 0xb9, 0xf2, 0x28, 0xbc, 0x02, 0x0f, 0x82, 0xec, 0xdd, 0x4d, 0x76, 0x93, 0x28, 0x45,
+	0xb9, 0x79, 0xc6, 0x63, 0xcf, 0xcc, 0x37, 0xdf, 0x7c, 0xb0, 0xe5, 0x5d, 0x33, 0xea, 0xbc, 0xf3,
+	0x88, 0x10, 0xd7, 0xdc, 0x77, 0x44, 0xd3, 0xf3, 0xb9, 0xe4, 0xa8, 0xa4, 0xdd, 0x53, 0xaf, 0x55,
+	0x1b, 0x70, 0x3e, 0x18, 0xd1, 0x16, 0xf1, 0xdc, 0x16, 0x61, 0x8c, 0x4b, 0x22, 0x5d, 0xce, 0xc2,
+	0x68, 0xeb, 0x41, 0x78, 0xab, 0xad, 0x8b, 0x49, 0xbf, 0x25, 0xdd, 0x31, 0x15, 0x92, 0x8c, 0xbd,
+	0x20, 0xc0, 0xfe, 0x66, 0x40, 0xfe, 0xd4, 0x15, 0x12, 0xd3, 0x8f, 0x13, 0x2a, 0x24, 0xda, 0x01,
+	0x18, 0x12, 0x31, 0xec, 0xf8, 0xb4, 0xef, 0xde, 0x54, 0x8d, 0xba, 0xd1, 0xc8, 0xe1, 0x98, 0x07,
+	0x1d, 0x80, 0xa9, 0xac, 0xee, 0x27, 0x8f, 0x56, 0x53, 0x75, 0xa3, 0x51, 0x6a, 0x57, 0x9b, 0xc9,
+	0x8a, 0x9a, 0xc7, 0xe1, 0x3d, 0x9e, 0x46, 0xaa, 0x5f, 0x89, 0xe3, 0x74, 0x88, 0xe3, 0xb8, 0x6c,
+	0x50, 0x4d, 0xd7, 0x8d, 0x86, 0x89, 0x63, 0x1e, 0x1b, 0x43, 0xa1, 0x13, 0xbe, 0x57, 0xaf, 0x11,
+	0x82, 0x8c, 0x7a, 0xab, 0xf3, 0x17, 0xb0, 0x3e, 0xa3, 0x0a, 0x64, 0x7b, 0x7c, 0xc2, 0xa4, 0x4e,
+	0x5b, 0xc4, 0x81, 0x81, 0xaa, 0xb0, 0xe9, 0x25, 0xbe, 0x8d, 0x4c, 0xfb, 0x97, 0x01, 0x95, 0xc3,
+	0x21, 0xed, 0x5d, 0x06, 0x95, 0x53, 0x11, 0xb5, 0x58, 0x83, 0x9c, 0x1f, 0x1c, 0x4f, 0x1c, 0x9d,
+	0x21, 0x83, 0x67, 0x8e, 0x39, 0x00, 0x52, 0x2b, 0x01, 0x48, 0xaf, 0x09, 0x40, 0x66, 0x01, 0x80,
+	0x4b, 0xd8, 0x9a, 0xab, 0x55, 0x78, 0x9c, 0x09, 0x7a, 0x4b, 0xb1, 0x07, 0xb0, 0xa1, 0x52, 0x50,
+	0x51, 0x4d, 0xd5, 0xd3, 0x8d, 0x7c, 0xbb, 0x36, 0x5f, 0x4a, 0x1c, 0x55, 0x1c, 0xc6, 0xda, 0xdf,
+	0x0d, 0xa8, 0x1c, 0xf1, 0x6b, 0x36, 0xe2, 0xc4, 0xc1, 0x84, 0x0d, 0x68, 0x84, 0x4c, 0x1d, 0xf2,
+	0x42, 0x12, 0x5f, 0x26, 0xa6, 0x1f, 0x77, 0xa9, 0x72, 0x28, 0x73, 0x12, 0xe0, 0xcc, 0x1c, 0xeb,
+	0x61, 0x63, 0xbf, 0x81, 0xec, 0xf9, 0x90, 0xf8, 0xce, 0xad, 0xdc, 0x43, 0x90, 0x71, 0x88, 0x24,
+	0x3a, 0x6f, 0x01, 0xeb, 0x33, 0xb2, 0xc0, 0xec, 0x29, 0xe0, 0xc4, 0x64, 0xac, 0x53, 0x16, 0xf1,
+	0xd4, 0xb6, 0xdf, 0x42, 0x59, 0x83, 0xaa, 0x9b, 0x0f, 0x5b, 0x5c, 0xc6, 0xac, 0xb5, 0x38, 0x6d,
+	0x3f, 0x83, 0xbb, 0xb1, 0xdf, 0xc3, 0x71, 0x55, 0x20, 0xdb, 0xe7, 0x13, 0x16, 0x8c, 0xca, 0xc4,
+	0x81, 0xb1, 0x9c, 0xba, 0xf6, 0x2b, 0x40, 0x47, 0x44, 0x12, 0x41, 0xe5, 0x09, 0xeb, 0xf3, 0xa8,
+	0xc0, 0x78, 0x31, 0xc6, 0x7f, 0x17, 0xf3, 0x3b, 0x05, 0xf9, 0xd8, 0x67, 0x6a, 0x2d, 0xae, 0xa8,
+	0x2f, 0x5c, 0xce, 0x42, 0x1c, 0x23, 0x53, 0xcd, 0xd8, 0xa7, 0x23, 0x4a, 0x04, 0x3d, 0x22, 0x92,
+	0x86, 0x33, 0x8c, 0xbb, 0xd6, 0x64, 0xb8, 0x0d, 0x05, 0x4f, 0x8f, 0xe9, 0x94, 0xb2, 0x81, 0x1c,
+	0x6a, 0x8e, 0x17, 0x71, 0xc2, 0xa7, 0xd8, 0xa3, 0xe2, 0x0f, 0x35, 0x16, 0xd9, 0x80, 0xcc, 0x53,
+	0x07, 0x7a, 0x0a, 0xb9, 0x8b, 0x89, 0x3b, 0x72, 0xba, 0xee, 0x98, 0x56, 0x37, 0xea, 0x46, 0x23,
+	0xdf, 0xb6, 0x9a, 0x81, 0x7e, 0x35, 0x23, 0xfd, 0x6a, 0x76, 0x23, 0xfd, 0xc2, 0xb3, 0xe0, 0x04,
+	0x09, 0x36, 0x75, 0x43, 0x53, 0x5b, 0xdd, 0x51, 0xd6, 0xe3, 0x7a, 0xef, 0xcc, 0xe0, 0x2e, 0xb2,
+	0x1f, 0xef, 0x80, 0x19, 0x75, 0x82, 0x4c, 0xc8, 0x9c, 0x1f, 0x3f, 0xdf, 0x2f, 0xdf, 0x51, 0xa7,
+	0xb3, 0xee, 0xe9, 0xeb, 0xb2, 0xd1, 0xfe, 0x99, 0x86, 0x52, 0x47, 0x75, 0x1e, 0xad, 0x91, 0x40,
+	0x37, 0x70, 0x4f, 0xc9, 0xe5, 0xb1, 0xde, 0xa4, 0x17, 0xdc, 0x0f, 0xa9, 0xb9, 0x3d, 0x8f, 0x50,
+	0x4c, 0x53, 0xad, 0x95, 0x5b, 0x69, 0xef, 0x7e, 0xfd, 0xf3, 0xf7, 0x47, 0x6a, 0x07, 0xd5, 0x5a,
+	0x57, 0xfb, 0xad, 0x60, 0x43, 0x5b, 0x9f, 0x67, 0xac, 0xff, 0xd2, 0x1a, 0xb9, 0x42, 0xee, 0x19,
+	0xe8, 0x3d, 0x14, 0x13, 0x12, 0x81, 0x76, 0xe7, 0xbf, 0x5d, 0xa6, 0x76, 0xd6, 0xa3, 0x5b, 0xa2,
+	0x02, 0xe2, 0x36, 0x8c, 0x3d, 0x03, 0x9d, 0x41, 0x31, 0x21, 0x0b, 0x8b, 0x19, 0x96, 0xa9, 0x86,
+	0xb5, 0x35, 0x1f, 0xa5, 0xb7, 0x79, 0xcf, 0x40, 0x3d, 0x28, 0xbd, 0xa4, 0x32, 0x4e, 0x4b, 0x7b,
+	0xe1, 0xc3, 0x85, 0x05, 0xb0, 0xb6, 0x57, 0xc4, 0xd8, 0x65, 0x0d, 0x16, 0x20, 0x53, 0x81, 0xe5,
+	0xb2, 0x3e, 0x6f, 0x7f, 0x80, 0xfb, 0xc9, 0x11, 0x9d, 0x30, 0x49, 0x7d, 0x46, 0x46, 0xa8, 0x03,
+	0xb9, 0xe9, 0x82, 0xa2, 0xfa, 0x52, 0x18, 0x62, 0xca, 0x60, 0x3d, 0x5c, 0x11, 0x11, 0x80, 0x74,
+	0xb1, 0xa1, 0x69, 0xf8, 0xe4, 0xdf, 0x00, 0x41, 0x3f, 0x66, 0xbf, 0x9b, 0x07, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -141,6 +708,13 @@ const _ = grpc.SupportPackageIsVersion4
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type PwnedPasswordsClient interface {
 	ListHashesForPrefix(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (PwnedPasswords_ListHashesForPrefixClient, error)
+	// CheckPrefixes returns hashes for many prefixes over a single stream.
+	// Responses are tagged with the requestId of the request they answer.
+	CheckPrefixes(ctx context.Context, opts ...grpc.CallOption) (PwnedPasswords_CheckPrefixesClient, error)
+	// DownloadRange streams encoded shards for all prefixes in the range in prefix order.
+	DownloadRange(ctx context.Context, in *DownloadRangeRequest, opts ...grpc.CallOption) (PwnedPasswords_DownloadRangeClient, error)
+	// GetDatasetInfo describes the dataset currently served for the hash type.
+	GetDatasetInfo(ctx context.Context, in *DatasetInfoRequest, opts ...grpc.CallOption) (*DatasetInfo, error)
 }
 
 type pwnedPasswordsClient struct {
@@ -183,9 +757,88 @@ func (x *pwnedPasswordsListHashesForPrefixClient) Recv() (*PasswordHash, error)
 	return m, nil
 }
 
+func (c *pwnedPasswordsClient) CheckPrefixes(ctx context.Context, opts ...grpc.CallOption) (PwnedPasswords_CheckPrefixesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_PwnedPasswords_serviceDesc.Streams[1], "/pwnedpasswords.PwnedPasswords/CheckPrefixes", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pwnedPasswordsCheckPrefixesClient{stream}
+	return x, nil
+}
+
+type PwnedPasswords_CheckPrefixesClient interface {
+	Send(*CheckPrefixesRequest) error
+	Recv() (*CheckPrefixesResponse, error)
+	grpc.ClientStream
+}
+
+type pwnedPasswordsCheckPrefixesClient struct {
+	grpc.ClientStream
+}
+
+func (x *pwnedPasswordsCheckPrefixesClient) Send(m *CheckPrefixesRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pwnedPasswordsCheckPrefixesClient) Recv() (*CheckPrefixesResponse, error) {
+	m := new(CheckPrefixesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pwnedPasswordsClient) DownloadRange(ctx context.Context, in *DownloadRangeRequest, opts ...grpc.CallOption) (PwnedPasswords_DownloadRangeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_PwnedPasswords_serviceDesc.Streams[2], "/pwnedpasswords.PwnedPasswords/DownloadRange", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pwnedPasswordsDownloadRangeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PwnedPasswords_DownloadRangeClient interface {
+	Recv() (*Shard, error)
+	grpc.ClientStream
+}
+
+type pwnedPasswordsDownloadRangeClient struct {
+	grpc.ClientStream
+}
+
+func (x *pwnedPasswordsDownloadRangeClient) Recv() (*Shard, error) {
+	m := new(Shard)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pwnedPasswordsClient) GetDatasetInfo(ctx context.Context, in *DatasetInfoRequest, opts ...grpc.CallOption) (*DatasetInfo, error) {
+	out := new(DatasetInfo)
+	err := c.cc.Invoke(ctx, "/pwnedpasswords.PwnedPasswords/GetDatasetInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PwnedPasswordsServer is the server API for PwnedPasswords service.
 type PwnedPasswordsServer interface {
 	ListHashesForPrefix(*ListRequest, PwnedPasswords_ListHashesForPrefixServer) error
+	// CheckPrefixes returns hashes for many prefixes over a single stream.
+	// Responses are tagged with the requestId of the request they answer.
+	CheckPrefixes(PwnedPasswords_CheckPrefixesServer) error
+	// DownloadRange streams encoded shards for all prefixes in the range in prefix order.
+	DownloadRange(*DownloadRangeRequest, PwnedPasswords_DownloadRangeServer) error
+	// GetDatasetInfo describes the dataset currently served for the hash type.
+	GetDatasetInfo(context.Context, *DatasetInfoRequest) (*DatasetInfo, error)
 }
 
 // UnimplementedPwnedPasswordsServer can be embedded to have forward compatible implementations.
@@ -195,6 +848,15 @@ type UnimplementedPwnedPasswordsServer struct {
 func (*UnimplementedPwnedPasswordsServer) ListHashesForPrefix(req *ListRequest, srv PwnedPasswords_ListHashesForPrefixServer) error {
 	return status.Errorf(codes.Unimplemented, "method ListHashesForPrefix not implemented")
 }
+func (*UnimplementedPwnedPasswordsServer) CheckPrefixes(srv PwnedPasswords_CheckPrefixesServer) error {
+	return status.Errorf(codes.Unimplemented, "method CheckPrefixes not implemented")
+}
+func (*UnimplementedPwnedPasswordsServer) DownloadRange(req *DownloadRangeRequest, srv PwnedPasswords_DownloadRangeServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadRange not implemented")
+}
+func (*UnimplementedPwnedPasswordsServer) GetDatasetInfo(ctx context.Context, req *DatasetInfoRequest) (*DatasetInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDatasetInfo not implemented")
+}
 
 func RegisterPwnedPasswordsServer(s *grpc.Server, srv PwnedPasswordsServer) {
 	s.RegisterService(&_PwnedPasswords_serviceDesc, srv)
@@ -221,16 +883,171 @@ func (x *pwnedPasswordsListHashesForPrefixServer) Send(m *PasswordHash) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _PwnedPasswords_CheckPrefixes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PwnedPasswordsServer).CheckPrefixes(&pwnedPasswordsCheckPrefixesServer{stream})
+}
+
+type PwnedPasswords_CheckPrefixesServer interface {
+	Send(*CheckPrefixesResponse) error
+	Recv() (*CheckPrefixesRequest, error)
+	grpc.ServerStream
+}
+
+type pwnedPasswordsCheckPrefixesServer struct {
+	grpc.ServerStream
+}
+
+func (x *pwnedPasswordsCheckPrefixesServer) Send(m *CheckPrefixesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pwnedPasswordsCheckPrefixesServer) Recv() (*CheckPrefixesRequest, error) {
+	m := new(CheckPrefixesRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PwnedPasswords_DownloadRange_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadRangeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PwnedPasswordsServer).DownloadRange(m, &pwnedPasswordsDownloadRangeServer{stream})
+}
+
+type PwnedPasswords_DownloadRangeServer interface {
+	Send(*Shard) error
+	grpc.ServerStream
+}
+
+type pwnedPasswordsDownloadRangeServer struct {
+	grpc.ServerStream
+}
+
+func (x *pwnedPasswordsDownloadRangeServer) Send(m *Shard) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PwnedPasswords_GetDatasetInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DatasetInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PwnedPasswordsServer).GetDatasetInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pwnedpasswords.PwnedPasswords/GetDatasetInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PwnedPasswordsServer).GetDatasetInfo(ctx, req.(*DatasetInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _PwnedPasswords_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pwnedpasswords.PwnedPasswords",
 	HandlerType: (*PwnedPasswordsServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDatasetInfo",
+			Handler:    _PwnedPasswords_GetDatasetInfo_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "ListHashesForPrefix",
 			Handler:       _PwnedPasswords_ListHashesForPrefix_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "CheckPrefixes",
+			Handler:       _PwnedPasswords_CheckPrefixes_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadRange",
+			Handler:       _PwnedPasswords_DownloadRange_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pwned_passwords.proto",
+}
+
+// PwnedPasswordsInternalClient is the client API for PwnedPasswordsInternal service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type PwnedPasswordsInternalClient interface {
+	// CheckHash reports whether the hash has been seen in breaches.
+	CheckHash(ctx context.Context, in *CheckHashRequest, opts ...grpc.CallOption) (*CheckHashResponse, error)
+}
+
+type pwnedPasswordsInternalClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewPwnedPasswordsInternalClient(cc *grpc.ClientConn) PwnedPasswordsInternalClient {
+	return &pwnedPasswordsInternalClient{cc}
+}
+
+func (c *pwnedPasswordsInternalClient) CheckHash(ctx context.Context, in *CheckHashRequest, opts ...grpc.CallOption) (*CheckHashResponse, error) {
+	out := new(CheckHashResponse)
+	err := c.cc.Invoke(ctx, "/pwnedpasswords.PwnedPasswordsInternal/CheckHash", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PwnedPasswordsInternalServer is the server API for PwnedPasswordsInternal service.
+type PwnedPasswordsInternalServer interface {
+	// CheckHash reports whether the hash has been seen in breaches.
+	CheckHash(context.Context, *CheckHashRequest) (*CheckHashResponse, error)
+}
+
+// UnimplementedPwnedPasswordsInternalServer can be embedded to have forward compatible implementations.
+type UnimplementedPwnedPasswordsInternalServer struct {
+}
+
+func (*UnimplementedPwnedPasswordsInternalServer) CheckHash(ctx context.Context, req *CheckHashRequest) (*CheckHashResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckHash not implemented")
+}
+
+func RegisterPwnedPasswordsInternalServer(s *grpc.Server, srv PwnedPasswordsInternalServer) {
+	s.RegisterService(&_PwnedPasswordsInternal_serviceDesc, srv)
+}
+
+func _PwnedPasswordsInternal_CheckHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckHashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PwnedPasswordsInternalServer).CheckHash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pwnedpasswords.PwnedPasswordsInternal/CheckHash",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PwnedPasswordsInternalServer).CheckHash(ctx, req.(*CheckHashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _PwnedPasswordsInternal_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "pwnedpasswords.PwnedPasswordsInternal",
+	HandlerType: (*PwnedPasswordsInternalServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CheckHash",
+			Handler:    _PwnedPasswordsInternal_CheckHash_Handler,
+		},
 	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "pwned_passwords.proto",
 }
@@ -28,6 +28,10 @@ var _ status.Status
 var _ = runtime.String
 var _ = utilities.NewDoubleArray
 
+var (
+	filter_PwnedPasswords_ListHashesForPrefix_0 = &utilities.DoubleArray{Encoding: map[string]int{"hashPrefix": 0}, Base: []int{1, 1, 0}, Check: []int{0, 1, 2}}
+)
+
 func request_PwnedPasswords_ListHashesForPrefix_0(ctx context.Context, marshaler runtime.Marshaler, client PwnedPasswordsClient, req *http.Request, pathParams map[string]string) (PwnedPasswords_ListHashesForPrefixClient, runtime.ServerMetadata, error) {
 	var protoReq ListRequest
 	var metadata runtime.ServerMetadata
@@ -50,6 +54,10 @@ func request_PwnedPasswords_ListHashesForPrefix_0(ctx context.Context, marshaler
 		return nil, metadata, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", "hashPrefix", err)
 	}
 
+	if err := runtime.PopulateQueryParameters(&protoReq, req.URL.Query(), filter_PwnedPasswords_ListHashesForPrefix_0); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
 	stream, err := client.ListHashesForPrefix(ctx, &protoReq)
 	if err != nil {
 		return nil, metadata, err
@@ -63,6 +71,23 @@ func request_PwnedPasswords_ListHashesForPrefix_0(ctx context.Context, marshaler
 
 }
 
+var (
+	filter_PwnedPasswords_GetDatasetInfo_0 = &utilities.DoubleArray{Encoding: map[string]int{}, Base: []int(nil), Check: []int(nil)}
+)
+
+func request_PwnedPasswords_GetDatasetInfo_0(ctx context.Context, marshaler runtime.Marshaler, client PwnedPasswordsClient, req *http.Request, pathParams map[string]string) (proto.Message, runtime.ServerMetadata, error) {
+	var protoReq DatasetInfoRequest
+	var metadata runtime.ServerMetadata
+
+	if err := runtime.PopulateQueryParameters(&protoReq, req.URL.Query(), filter_PwnedPasswords_GetDatasetInfo_0); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	msg, err := client.GetDatasetInfo(ctx, &protoReq, grpc.Header(&metadata.HeaderMD), grpc.Trailer(&metadata.TrailerMD))
+	return msg, metadata, err
+
+}
+
 // RegisterPwnedPasswordsHandlerFromEndpoint is same as RegisterPwnedPasswordsHandler but
 // automatically dials to "endpoint" and closes the connection when "ctx" gets done.
 func RegisterPwnedPasswordsHandlerFromEndpoint(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) (err error) {
@@ -121,13 +146,37 @@ func RegisterPwnedPasswordsHandlerClient(ctx context.Context, mux *runtime.Serve
 
 	})
 
+	mux.Handle("GET", pattern_PwnedPasswords_GetDatasetInfo_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+		rctx, err := runtime.AnnotateContext(ctx, mux, req)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+		resp, md, err := request_PwnedPasswords_GetDatasetInfo_0(rctx, inboundMarshaler, client, req, pathParams)
+		ctx = runtime.NewServerMetadataContext(ctx, md)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+
+		forward_PwnedPasswords_GetDatasetInfo_0(ctx, mux, outboundMarshaler, w, req, resp, mux.GetForwardResponseOptions()...)
+
+	})
+
 	return nil
 }
 
 var (
 	pattern_PwnedPasswords_ListHashesForPrefix_0 = runtime.MustPattern(runtime.NewPattern(1, []int{2, 0, 2, 1, 1, 0, 4, 1, 5, 2, 2, 3}, []string{"v1", "hashes", "hashPrefix", "list"}, ""))
+
+	pattern_PwnedPasswords_GetDatasetInfo_0 = runtime.MustPattern(runtime.NewPattern(1, []int{2, 0, 2, 1}, []string{"v1", "info"}, ""))
 )
 
 var (
 	forward_PwnedPasswords_ListHashesForPrefix_0 = runtime.ForwardResponseStream
+
+	forward_PwnedPasswords_GetDatasetInfo_0 = runtime.ForwardResponseMessage
 )
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/arjantop/pwned-passwords/internal/storage"
+	"github.com/arjantop/pwned-passwords/pwnedpasswords"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// internalServer serves RPCs that are only exposed to trusted callers on a separate listener.
+type internalServer struct {
+	*server
+}
+
+func hashSize(hashType pwnedpasswords.HashType) int {
+	if hashType == pwnedpasswords.HashType_NTLM {
+		return storage.HashTypeNTLM.Size()
+	}
+	return storage.HashTypeSHA1.Size()
+}
+
+func (s *internalServer) CheckHash(ctx context.Context, req *pwnedpasswords.CheckHashRequest) (*pwnedpasswords.CheckHashResponse, error) {
+	st, err := s.storageFor(req.HashType)
+	if err != nil {
+		return nil, err
+	}
+	if size := hashSize(req.HashType); len(req.Hash) != size {
+		return nil, status.Errorf(codes.InvalidArgument, "%s hash must be %d bytes long", req.HashType, size)
+	}
+
+	ctx = storage.Pin(ctx, st)
+	prefix := storage.ManifestOf(ctx, st).HashPrefix(req.Hash)
+	result, found, err := storage.Find(ctx, st, prefix, req.Hash)
+	if err != nil {
+		return nil, storageError(prefix, err)
+	}
+
+	return &pwnedpasswords.CheckHashResponse{
+		Found: found,
+		Count: result.Count,
+	}, nil
+}
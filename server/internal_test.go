@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"testing"
+	"time"
+
+	"github.com/arjantop/pwned-passwords/internal/grpctest"
+	"github.com/arjantop/pwned-passwords/internal/storage"
+	"github.com/arjantop/pwned-passwords/pwnedpasswords"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func createInternalService(s *server) (pwnedpasswords.PwnedPasswordsInternalClient, *grpctest.Server) {
+	testServer := grpctest.NewServer(func(srv *grpc.Server) {
+		pwnedpasswords.RegisterPwnedPasswordsInternalServer(srv, &internalServer{s})
+	})
+
+	return pwnedpasswords.NewPwnedPasswordsInternalClient(testServer.ClientConn()), testServer
+}
+
+func TestInternalServerCheckHashFindsExactHash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pwned := sha1.Sum([]byte("password"))
+	other := sha1.Sum([]byte("other"))
+	// Both hashes are served from the same shard to check the exact match.
+	other[0], other[1], other[2] = pwned[0], pwned[1], pwned[2]
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "5baa6").Return([]storage.Hash{
+		{Hash: pwned[:], Count: 3861493},
+	}, nil).Times(2)
+
+	c, s := createInternalService(&server{storage: mockStorage})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := c.CheckHash(ctx, &pwnedpasswords.CheckHashRequest{Hash: pwned[:]})
+	if assert.NoError(t, err) {
+		assert.True(t, resp.Found)
+		assert.Equal(t, uint32(3861493), resp.Count)
+	}
+
+	resp, err = c.CheckHash(ctx, &pwnedpasswords.CheckHashRequest{Hash: other[:]})
+	if assert.NoError(t, err) {
+		assert.False(t, resp.Found)
+		assert.Equal(t, uint32(0), resp.Count)
+	}
+}
+
+func TestInternalServerCheckHashFailsForHashOfInvalidLength(t *testing.T) {
+	c, s := createInternalService(&server{storage: &errorStorage{}, ntlmStorage: &errorStorage{}})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hash := sha1.Sum([]byte("password"))
+	_, err := c.CheckHash(ctx, &pwnedpasswords.CheckHashRequest{
+		Hash:     hash[:],
+		HashType: pwnedpasswords.HashType_NTLM,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = c.CheckHash(ctx, &pwnedpasswords.CheckHashRequest{Hash: hash[:5]})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/arjantop/pwned-passwords/internal/storage"
+	"github.com/arjantop/pwned-passwords/pwnedpasswords"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Padded responses contain at least paddingFloor plus a random number of up to
+	// paddingJitter hashes.
+	paddingFloor  = 800
+	paddingJitter = 200
+
+	// paddingHeader requests padding over HTTP like the Add-Padding header of the HIBP API.
+	paddingHeader = "add-padding"
+)
+
+// paddingRequested reports whether padding was requested in the request or its metadata.
+func paddingRequested(ctx context.Context, addPadding bool) bool {
+	if addPadding {
+		return true
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get(paddingHeader) {
+		if strings.EqualFold(v, "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// paddingHeaderMatcher forwards the padding header from HTTP requests to the gRPC metadata.
+func paddingHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, paddingHeader) {
+		return paddingHeader, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// toPasswordHashes converts hashes to responses, adding decoy hashes with the same
+// prefix if padding is requested.
+func toPasswordHashes(hashType pwnedpasswords.HashType, prefix string, hashes []storage.Hash, padding bool) ([]*pwnedpasswords.PasswordHash, error) {
+	result := make([]*pwnedpasswords.PasswordHash, 0, len(hashes))
+	for _, h := range hashes {
+		result = append(result, &pwnedpasswords.PasswordHash{
+			Hash:  h.Hash,
+			Count: h.Count,
+		})
+	}
+	if !padding {
+		return result, nil
+	}
+
+	jitter, err := rand.Int(rand.Reader, big.NewInt(paddingJitter+1))
+	if err != nil {
+		return nil, errors.WithMessage(err, "generating padding size failed")
+	}
+	for target := paddingFloor + int(jitter.Int64()); len(result) < target; {
+		decoy, err := decoyHash(hashSize(hashType), prefix)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &pwnedpasswords.PasswordHash{
+			Hash:    decoy,
+			Padding: true,
+		})
+	}
+
+	// Decoys are mixed with the real hashes so their position reveals nothing.
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Hash, result[j].Hash) < 0
+	})
+
+	return result, nil
+}
+
+// decoyHash returns a random hash of the given size starting with the hex prefix.
+func decoyHash(size int, prefix string) ([]byte, error) {
+	hash := make([]byte, size)
+	if _, err := rand.Read(hash); err != nil {
+		return nil, errors.WithMessage(err, "generating decoy hash failed")
+	}
+
+	// Odd length prefixes set the high nibble of the last prefix byte.
+	prefixBytes, err := hex.DecodeString(prefix + strings.Repeat("0", len(prefix)%2))
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid prefix")
+	}
+	last := len(prefixBytes) - 1
+	random := hash[last]
+	copy(hash, prefixBytes)
+	if len(prefix)%2 == 1 {
+		hash[last] = prefixBytes[last] | random&0x0f
+	}
+
+	return hash, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/arjantop/pwned-passwords/internal/storage"
+	"github.com/arjantop/pwned-passwords/pwnedpasswords"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestServerListHashesForPrefixPadsResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stored := []storage.Hash{{Hash: append([]byte{0xab, 0xcd, 0xe1}, bytes.Repeat([]byte{1}, 17)...), Count: 3}}
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "abcde").Return(stored, nil).Times(2)
+
+	c, s := createService(mockStorage)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	requests := []struct {
+		ctx context.Context
+		req *pwnedpasswords.ListRequest
+	}{
+		{ctx, &pwnedpasswords.ListRequest{HashPrefix: "abcde", AddPadding: true}},
+		{metadata.AppendToOutgoingContext(ctx, paddingHeader, "true"), &pwnedpasswords.ListRequest{HashPrefix: "abcde"}},
+	}
+	for _, r := range requests {
+		resp, err := c.ListHashesForPrefix(r.ctx, r.req)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		var hashes, decoys int
+		for {
+			h, err := resp.Recv()
+			if err != nil {
+				break
+			}
+			assert.Equal(t, "abcde", hex.EncodeToString(h.Hash)[:5])
+			assert.Len(t, h.Hash, 20)
+			if h.Padding {
+				decoys++
+				assert.Equal(t, uint32(0), h.Count)
+			} else {
+				hashes++
+				assert.Equal(t, stored[0].Hash, h.Hash)
+			}
+		}
+
+		assert.Equal(t, 1, hashes)
+		assert.True(t, hashes+decoys >= paddingFloor && hashes+decoys <= paddingFloor+paddingJitter, "%d hashes", hashes+decoys)
+	}
+}
+
+func TestDecoyHashHasPrefix(t *testing.T) {
+	for _, prefix := range []string{"abcde", "abcd", "0"} {
+		hash, err := decoyHash(16, prefix)
+		if assert.NoError(t, err) {
+			assert.Len(t, hash, 16)
+			assert.Equal(t, prefix, hex.EncodeToString(hash)[:len(prefix)])
+		}
+	}
+}
+
+func TestPaddingHeaderMatcher(t *testing.T) {
+	key, ok := paddingHeaderMatcher("Add-Padding")
+	assert.True(t, ok)
+	assert.Equal(t, paddingHeader, key)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/arjantop/pwned-passwords/pwnedpasswords"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rangePath is the path of the range endpoint of the HIBP API.
+const rangePath = "/range/"
+
+// rangeHandler serves hashes in the plaintext format of the range endpoint of the
+// HIBP API so existing clients can be pointed at the server unchanged.
+//
+// Every line of the response contains the uppercase hex suffix of a hash following
+// the prefix and its count separated by a colon. NTLM hashes are served with the
+// mode=ntlm query parameter and padding is requested with the Add-Padding header.
+type rangeHandler struct {
+	srv *server
+}
+
+func (h *rangeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hashType := pwnedpasswords.HashType_SHA1
+	switch mode := r.URL.Query().Get("mode"); strings.ToLower(mode) {
+	case "", "sha1":
+	case "ntlm":
+		hashType = pwnedpasswords.HashType_NTLM
+	default:
+		http.Error(w, fmt.Sprintf("Unknown mode '%s'", mode), http.StatusBadRequest)
+		return
+	}
+
+	prefix, err := normalizePrefix(strings.TrimPrefix(r.URL.Path, rangePath))
+	if err != nil {
+		writeRangeError(w, err)
+		return
+	}
+
+	hashes, err := h.srv.hashesForPrefix(r.Context(), hashType, prefix)
+	if status.Code(err) == codes.NotFound {
+		// Datasets do not necessarily contain hashes for every prefix.
+		hashes, err = nil, nil
+	}
+	if err != nil {
+		writeRangeError(w, err)
+		return
+	}
+
+	padding := strings.EqualFold(r.Header.Get(paddingHeader), "true")
+	result, err := toPasswordHashes(hashType, prefix, hashes, padding)
+	if err != nil {
+		writeRangeError(w, status.Error(codes.Internal, err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, hash := range result {
+		suffix := strings.ToUpper(hex.EncodeToString(hash.Hash))[len(prefix):]
+		fmt.Fprintf(bw, "%s:%d\r\n", suffix, hash.Count)
+	}
+	bw.Flush()
+}
+
+// writeRangeError writes the gRPC status error as a plaintext response with the
+// corresponding HTTP status code.
+func writeRangeError(w http.ResponseWriter, err error) {
+	s := status.Convert(err)
+	http.Error(w, s.Message(), runtime.HTTPStatusFromCode(s.Code()))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arjantop/pwned-passwords/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveRange(srv *server, target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	(&rangeHandler{srv: srv}).ServeHTTP(w, r)
+	return w
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestRangeHandlerServesHashesInHIBPFormat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "21bd1").Return([]storage.Hash{
+		{Hash: mustDecodeHex(t, "21bd10018a45c4d1def81644b54ab7f969b88d65"), Count: 1},
+		{Hash: mustDecodeHex(t, "21bd100d4f6e8fa6eecad2a3aa415eec418d38ec"), Count: 42},
+	}, nil)
+
+	w := serveRange(&server{storage: mockStorage}, "/range/21BD1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.Equal(t, "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n00D4F6E8FA6EECAD2A3AA415EEC418D38EC:42\r\n", w.Body.String())
+}
+
+func TestRangeHandlerServesNTLMHashesWithPadding(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "abcde").Return([]storage.Hash{
+		{Hash: mustDecodeHex(t, "abcde000000000000000000000000001"), Count: 3},
+	}, nil)
+
+	w := serveRange(&server{ntlmStorage: mockStorage}, "/range/abcde?mode=ntlm", http.Header{"Add-Padding": {"true"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\r\n"), "\r\n")
+	assert.True(t, len(lines) >= paddingFloor)
+	assert.Contains(t, lines, "000000000000000000000000001:3")
+	for _, line := range lines {
+		assert.Len(t, strings.Split(line, ":")[0], 27)
+		if line != "000000000000000000000000001:3" {
+			assert.True(t, strings.HasSuffix(line, ":0"), "decoys have zero count")
+		}
+	}
+}
+
+func TestRangeHandlerReturnsEmptyResponseForMissingShard(t *testing.T) {
+	w := serveRange(&server{storage: &errorStorage{storage.ErrNotFound}}, "/range/abcde", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestRangeHandlerFailsForInvalidRequests(t *testing.T) {
+	srv := &server{storage: &errorStorage{errors.New("my error")}}
+
+	tests := []struct {
+		name   string
+		target string
+		code   int
+	}{
+		{"not hexadecimal", "/range/zzzzz", http.StatusBadRequest},
+		{"path escape", "/range/..%2F..", http.StatusBadRequest},
+		{"invalid length", "/range/abc", http.StatusBadRequest},
+		{"unknown mode", "/range/abcde?mode=md5", http.StatusBadRequest},
+		{"unavailable dataset", "/range/abcde?mode=ntlm", http.StatusNotImplemented},
+		{"storage failure", "/range/abcde", http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serveRange(srv, tc.target, nil)
+			assert.Equal(t, tc.code, w.Code)
+			assert.False(t, bytes.Contains(w.Body.Bytes(), []byte("my error")))
+		})
+	}
+}
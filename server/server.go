@@ -3,10 +3,17 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/arjantop/pwned-passwords/internal/grpcbase"
 
@@ -14,38 +21,291 @@ import (
 
 	"github.com/arjantop/pwned-passwords/internal/storage"
 	"github.com/arjantop/pwned-passwords/pwnedpasswords"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
 var (
 	listenOn       = flag.String("listen", "", "Interface and port the server will listen on")
-	dataDir        = flag.String("dataDir", "", "Directory where password data is located")
+	internalListen = flag.String("internalListen", "", "Interface and port of the listener for trusted callers serving exact hash checks (disabled if empty)")
+	dataDir        = flag.String("dataDir", "", "Directory where SHA-1 password data is located (a prefix in the bucket if s3Bucket is set)")
+	ntlmDataDir    = flag.String("ntlmDataDir", "", "Directory where NTLM password data is located (a prefix in the bucket if s3Bucket is set)")
 	jaegerEndpoint = flag.String("jaegerEndpoint", "", "Endpoint of jaeger tracing")
+
+	tlsCertFile     = flag.String("tlsCertFile", "", "PEM encoded certificate of the gRPC server (TLS is enabled if set together with tlsKeyFile, reloaded on SIGHUP)")
+	tlsKeyFile      = flag.String("tlsKeyFile", "", "PEM encoded private key of the gRPC server")
+	tlsClientCAFile = flag.String("tlsClientCAFile", "", "PEM encoded CA certificates that must have signed client certificates (enables mutual TLS)")
+
+	gatewayListen          = flag.String("gatewayListen", ":8990", "Interface and port the HTTP gateway will listen on (disabled if empty)")
+	gatewayCertFile        = flag.String("gatewayCertFile", "", "PEM encoded certificate of the HTTP gateway (TLS is enabled if set together with gatewayKeyFile)")
+	gatewayKeyFile         = flag.String("gatewayKeyFile", "", "PEM encoded private key of the HTTP gateway")
+	gatewayReadTimeout     = flag.Duration("gatewayReadTimeout", 10*time.Second, "Maximum duration of reading an HTTP request including the body")
+	gatewayWriteTimeout    = flag.Duration("gatewayWriteTimeout", 30*time.Second, "Maximum duration of writing an HTTP response")
+	gatewayIdleTimeout     = flag.Duration("gatewayIdleTimeout", 2*time.Minute, "Maximum time an idle HTTP keep-alive connection is kept open")
+	gatewayShutdownTimeout = flag.Duration("gatewayShutdownTimeout", 30*time.Second, "Maximum time in-flight HTTP requests are waited for on shutdown")
+
+	cacheSize               = flag.Int64("cacheSize", 0, "Maximum size in bytes of the in-memory cache of each dataset (0 disables caching)")
+	generationCheckInterval = flag.Duration("generationCheckInterval", 10*time.Second, "How often data directories are checked for a new current generation (0 disables checking)")
+	readinessSamples        = flag.Int("readinessSamples", 16, "Number of shards of each dataset read to check that the server is ready and that opened datasets are usable")
+
+	apiKeyFile = flag.String("apiKeyFile", "", "File with a tenant and its API key on every line that clients must authenticate with (authentication is disabled if empty, reloaded on SIGHUP)")
+
+	rateLimit      = flag.Float64("rateLimit", 0, "Requests per second each client can make on average over gRPC and the HTTP gateway (0 disables rate limiting)")
+	rateLimitBurst = flag.Int("rateLimitBurst", 100, "Number of requests each client can make at once before it is rate limited")
+
+	s3Endpoint = flag.String("s3Endpoint", "https://s3.amazonaws.com", "Endpoint of the S3 compatible object storage")
+	s3Region   = flag.String("s3Region", "us-east-1", "Region of the S3 bucket")
+	s3Bucket   = flag.String("s3Bucket", "", "S3 bucket to read password data from instead of the local filesystem (credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	s3CacheDir = flag.String("s3CacheDir", "", "Local directory where shards read from S3 are kept and served from on subsequent requests (cleared when the dataset changes)")
 )
 
-const prefixLength = 5
+// prefixLengthKey is the trailer with the prefix length of the dataset sent with
+// errors caused by prefixes of the wrong length.
+const prefixLengthKey = "prefix-length"
+
+// verifyTimeout bounds the time verifying a newly opened dataset may take.
+const verifyTimeout = 30 * time.Second
+
+// downloadRangeMethod is the full gRPC method name of DownloadRange.
+const downloadRangeMethod = "/pwnedpasswords.PwnedPasswords/DownloadRange"
 
 type server struct {
-	storage storage.Storage
+	storage     storage.Storage
+	ntlmStorage storage.Storage
 }
 
-func (s *server) ListHashesForPrefix(req *pwnedpasswords.ListRequest, resp pwnedpasswords.PwnedPasswords_ListHashesForPrefixServer) error {
-	if len(req.HashPrefix) != prefixLength {
-		return status.Errorf(codes.InvalidArgument, "prefix length must be %d", prefixLength)
+// storageFor returns the storage holding the dataset of the requested hash type.
+func (s *server) storageFor(hashType pwnedpasswords.HashType) (storage.Storage, error) {
+	var st storage.Storage
+	switch hashType {
+	case pwnedpasswords.HashType_SHA1:
+		st = s.storage
+	case pwnedpasswords.HashType_NTLM:
+		st = s.ntlmStorage
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown hash type %s", hashType)
+	}
+	if st == nil {
+		return nil, status.Errorf(codes.Unimplemented, "%s dataset is not available", hashType)
 	}
+	return st, nil
+}
 
-	hashes, err := s.storage.Get(resp.Context(), req.HashPrefix)
+// hashesForPrefix fetches hashes for a prefix from the dataset of the requested hash type.
+// Returned errors are gRPC status errors.
+func (s *server) hashesForPrefix(ctx context.Context, hashType pwnedpasswords.HashType, prefix string) ([]storage.Hash, error) {
+	st, err := s.storageFor(hashType)
 	if err != nil {
-		log.Printf("Faled fething from storage for prefix '%s': %v", req.HashPrefix, err)
+		return nil, err
+	}
+
+	// The prefix length is only valid for the generation it was read from.
+	ctx = storage.Pin(ctx, st)
+	if err := checkPrefixLength(ctx, storage.ManifestOf(ctx, st), prefix); err != nil {
+		return nil, err
+	}
+
+	hashes, err := st.Get(ctx, prefix)
+	if err != nil {
+		return nil, storageError(prefix, err)
+	}
+
+	return hashes, nil
+}
+
+// normalizePrefix converts the prefix to lowercase and checks that it is hexadecimal.
+// Prefixes are accepted in either case for compatibility with the HIBP API.
+func normalizePrefix(prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+	if !storage.IsValidKey(prefix) {
+		return "", status.Error(codes.InvalidArgument, "prefix must be hexadecimal")
+	}
+	return prefix, nil
+}
+
+// checkPrefixLength checks that the prefix has the length of the prefixes of the dataset.
+// Clients learn the expected length from the trailer sent with the error.
+func checkPrefixLength(ctx context.Context, m storage.Manifest, prefix string) error {
+	if len(prefix) == m.PrefixLength {
+		return nil
+	}
+
+	grpc.SetTrailer(ctx, metadata.Pairs(prefixLengthKey, strconv.Itoa(m.PrefixLength)))
+	return status.Errorf(codes.InvalidArgument, "prefix length must be %d", m.PrefixLength)
+}
+
+// storageError logs the storage error and converts it to a gRPC status error
+// without exposing any details.
+func storageError(prefix string, err error) error {
+	switch cause := errors.Cause(err); {
+	case cause == context.Canceled || cause == context.DeadlineExceeded:
+		return status.FromContextError(cause).Err()
+	case storage.IsNotFound(err):
+		return status.Errorf(codes.NotFound, "No data for prefix '%s'", prefix)
+	}
+
+	log.Printf("Faled fething from storage for prefix '%s': %v", prefix, err)
+	switch {
+	case storage.IsCorrupted(err):
+		return status.Error(codes.DataLoss, "Stored data is corrupted")
+	case storage.IsTransient(err):
+		return status.Error(codes.Unavailable, "Storage is temporarily unavailable")
+	default:
 		return status.Error(codes.Internal, "Something went wrong")
 	}
+}
+
+// parsePrefixRange parses an inclusive range of prefixes. Empty bounds default to
+// the first and the last possible prefix.
+func parsePrefixRange(start, end string, prefixLength int) (uint64, uint64, error) {
+	first, last := uint64(0), uint64(1)<<uint(4*prefixLength)-1
+
+	parse := func(name, prefix string, result *uint64) error {
+		if prefix == "" {
+			return nil
+		}
+		if len(prefix) != prefixLength {
+			return status.Errorf(codes.InvalidArgument, "%s prefix length must be %d", name, prefixLength)
+		}
+		n, err := strconv.ParseUint(prefix, 16, 64)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "%s prefix must be hexadecimal", name)
+		}
+		*result = n
+		return nil
+	}
+
+	if err := parse("start", start, &first); err != nil {
+		return 0, 0, err
+	}
+	if err := parse("end", end, &last); err != nil {
+		return 0, 0, err
+	}
+	if first > last {
+		return 0, 0, status.Error(codes.InvalidArgument, "start prefix must not be after end prefix")
+	}
+
+	return first, last, nil
+}
+
+func formatPrefix(n uint64, prefixLength int) string {
+	return fmt.Sprintf("%0*x", prefixLength, n)
+}
+
+// pin makes all requests with the returned context see the same data even if
+// a new generation of a dataset starts being served in the meantime.
+func (s *server) pin(ctx context.Context) context.Context {
+	for _, st := range []storage.Storage{s.storage, s.ntlmStorage} {
+		if st != nil {
+			ctx = storage.Pin(ctx, st)
+		}
+	}
+	return ctx
+}
+
+func (s *server) ListHashesForPrefix(req *pwnedpasswords.ListRequest, resp pwnedpasswords.PwnedPasswords_ListHashesForPrefixServer) error {
+	prefix, err := normalizePrefix(req.HashPrefix)
+	if err != nil {
+		return err
+	}
+
+	hashes, err := s.hashesForPrefix(resp.Context(), req.HashType, prefix)
+	if err != nil {
+		return err
+	}
+
+	padded, err := toPasswordHashes(req.HashType, prefix, hashes, paddingRequested(resp.Context(), req.AddPadding))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	for _, h := range padded {
+		if err := resp.Send(h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *server) CheckPrefixes(stream pwnedpasswords.PwnedPasswords_CheckPrefixesServer) error {
+	ctx := s.pin(stream.Context())
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		prefix, err := normalizePrefix(req.HashPrefix)
+		if err != nil {
+			return err
+		}
+
+		hashes, err := s.hashesForPrefix(ctx, req.HashType, prefix)
+		if err != nil {
+			return err
+		}
+
+		padded, err := toPasswordHashes(req.HashType, prefix, hashes, paddingRequested(ctx, req.AddPadding))
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		resp := &pwnedpasswords.CheckPrefixesResponse{
+			RequestId: req.RequestId,
+			Hashes:    padded,
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) DownloadRange(req *pwnedpasswords.DownloadRangeRequest, resp pwnedpasswords.PwnedPasswords_DownloadRangeServer) error {
+	st, err := s.storageFor(req.HashType)
+	if err != nil {
+		return err
+	}
+
+	ctx := s.pin(resp.Context())
+	prefixLength := storage.ManifestOf(ctx, st).PrefixLength
+	first, last, err := parsePrefixRange(req.StartPrefix, req.EndPrefix, prefixLength)
+	if err != nil {
+		return err
+	}
+	for n := first; n <= last; n++ {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		prefix := formatPrefix(n, prefixLength)
+		shard, err := st.GetShard(ctx, prefix)
+		if storage.IsNotFound(err) {
+			// Datasets do not necessarily contain hashes for every prefix.
+			continue
+		}
+		if err != nil {
+			return storageError(prefix, err)
+		}
+
+		header, err := storage.DecodeShardHeader(shard)
+		if err != nil {
+			return storageError(prefix, err)
+		}
 
-	for _, h := range hashes {
-		err := resp.Send(&pwnedpasswords.PasswordHash{
-			Hash: h,
+		err = resp.Send(&pwnedpasswords.Shard{
+			HashPrefix: prefix,
+			Data:       shard,
+			Checksum:   header.Checksum,
 		})
 		if err != nil {
 			return err
@@ -55,26 +315,196 @@ func (s *server) ListHashesForPrefix(req *pwnedpasswords.ListRequest, resp pwned
 	return nil
 }
 
-func registerHttpServer(conn *grpc.ClientConn) {
-	ctx, cancel := context.WithCancel(context.Background())
+func (s *server) GetDatasetInfo(ctx context.Context, req *pwnedpasswords.DatasetInfoRequest) (*pwnedpasswords.DatasetInfo, error) {
+	st, err := s.storageFor(req.HashType)
+	if err != nil {
+		return nil, err
+	}
+
+	m := storage.ManifestOf(ctx, st)
+	info := &pwnedpasswords.DatasetInfo{
+		Version:     m.Version,
+		ReleaseDate: m.ReleaseDate,
+		// The hash type of the manifest is checked when the dataset is opened but
+		// it is unknown for datasets without one.
+		HashType:     req.HashType,
+		PrefixLength: uint32(m.PrefixLength),
+		HashCount:    m.HashCount,
+		Checksum:     m.Checksum,
+	}
+	if m.Encoding != 0 {
+		info.Encoding = m.Encoding.String()
+	}
+	if !m.BuildTime.IsZero() {
+		if info.BuildTime, err = ptypes.TimestampProto(m.BuildTime); err != nil {
+			return nil, status.Errorf(codes.Internal, "invalid build time: %s", err)
+		}
+	}
+
+	return info, nil
+}
+
+// gatewayHandler returns the handler of the HTTP gateway. Requests to the gRPC-gateway
+// routes are forwarded to the gRPC server over conn.
+func gatewayHandler(ctx context.Context, conn *grpc.ClientConn, srv *server) (http.Handler, error) {
+	gwmux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(paddingHeaderMatcher))
+	if err := pwnedpasswords.RegisterPwnedPasswordsHandler(ctx, gwmux, conn); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", gwmux)
+	mux.Handle(rangePath, &rangeHandler{srv: srv})
+	return mux, nil
+}
+
+// openDataDir opens the current generation of the data directory with hashes of the given type.
+func openDataDir(dir string, hashType storage.HashType) (*storage.GenerationalStorage, error) {
+	return storage.NewGenerationalStorage(dir, func(dir string) (storage.Storage, error) {
+		m, err := storage.ReadManifest(dir)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkManifest(m, hashType); err != nil {
+			return nil, err
+		}
+
+		st, err := storage.OpenLocalStorage(dir, hashType)
+		if err != nil {
+			return nil, err
+		}
+		if *cacheSize > 0 {
+			// Every generation gets its own cache so reloading also invalidates it.
+			st = storage.NewCachedStorage(st, *cacheSize)
+		}
+		return verifyDataset(storage.WithManifest(st, m))
+	})
+}
+
+// verifyDataset checks a newly opened dataset so a half-copied or corrupted one never
+// replaces the dataset being served.
+func verifyDataset(st storage.Storage) (storage.Storage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
 	defer cancel()
+	if err := storage.Verify(ctx, st, *readinessSamples); err != nil {
+		return nil, errors.WithMessage(err, "verifying dataset failed")
+	}
+	return st, nil
+}
 
-	mux := runtime.NewServeMux()
-	if err := pwnedpasswords.RegisterPwnedPasswordsHandler(ctx, mux, conn); err != nil {
-		log.Fatal(err)
+// checkManifest checks that the dataset described by the manifest contains hashes of the given type.
+func checkManifest(m storage.Manifest, hashType storage.HashType) error {
+	if m.HashType != 0 && m.HashType != hashType {
+		return errors.Errorf("dataset contains %s hashes, expected %s", m.HashType, hashType)
+	}
+	return nil
+}
+
+// openS3 opens the dataset stored under prefix in the configured S3 bucket. Reopening
+// it reads the manifest again and discards the cache.
+func openS3(prefix string, hashType storage.HashType) (*storage.GenerationalStorage, error) {
+	return storage.NewReopenableStorage(func() (storage.Storage, error) {
+		return openS3Dataset(prefix, hashType)
+	})
+}
+
+// s3CacheDirFor returns the local directory where shards of the dataset described by
+// the manifest are kept. Every release gets its own directory so shards of different
+// releases are never mixed, directories of other releases are removed.
+func s3CacheDirFor(prefix string, m storage.Manifest) (string, error) {
+	release := "default"
+	switch {
+	case storage.IsValidKey(m.Checksum):
+		release = m.Checksum
+	case !m.BuildTime.IsZero():
+		release = m.BuildTime.UTC().Format("20060102T150405Z")
+	}
+
+	dir := path.Join(*s3CacheDir, prefix)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", errors.WithMessage(err, "reading S3 cache directory failed")
+	}
+	for _, e := range entries {
+		if e.Name() != release {
+			if err := os.RemoveAll(path.Join(dir, e.Name())); err != nil {
+				return "", errors.WithMessage(err, "removing stale S3 cache failed")
+			}
+		}
+	}
+	return path.Join(dir, release), nil
+}
+
+func openS3Dataset(prefix string, hashType storage.HashType) (storage.Storage, error) {
+	s3Backend := &storage.S3Backend{
+		Endpoint:        *s3Endpoint,
+		Bucket:          *s3Bucket,
+		Prefix:          prefix,
+		Region:          *s3Region,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+
+	m := storage.DefaultManifest()
+	r, err := s3Backend.ReadObject(context.Background(), storage.ManifestFileName)
+	if err != nil && !storage.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer r.Close()
+		if m, err = storage.DecodeManifest(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkManifest(m, hashType); err != nil {
+		return nil, err
+	}
+
+	var backend storage.Backend = s3Backend
+	if *s3CacheDir != "" {
+		cacheDir, err := s3CacheDirFor(prefix, m)
+		if err != nil {
+			return nil, err
+		}
+		backend = &storage.TieredBackend{
+			Tiers: []storage.Tier{
+				{Name: "local", Backend: &storage.LocalBackend{Dir: cacheDir}},
+				{Name: "s3", Backend: backend},
+			},
+			WriteThrough: true,
+		}
 	}
 
-	go func() {
-		if err := http.ListenAndServe(":8990", mux); err != nil {
-			log.Fatal(err)
+	var st storage.Storage = &storage.ObjectStorage{
+		Backend:  backend,
+		HashType: hashType,
+	}
+	if *cacheSize > 0 {
+		st = storage.NewCachedStorage(st, *cacheSize)
+	}
+	return verifyDataset(storage.WithManifest(st, m))
+}
+
+// watchGenerations periodically switches storages to the current generation of their data directories.
+func watchGenerations(interval time.Duration, storages map[string]*storage.GenerationalStorage) {
+	for range time.Tick(interval) {
+		for dir, st := range storages {
+			previous := st.Generation()
+			if err := st.Reload(); err != nil {
+				log.Printf("Could not reload data directory '%s': %v", dir, err)
+				continue
+			}
+			if current := st.Generation(); current != previous {
+				log.Printf("Switched data directory '%s' from generation '%s' to '%s'", dir, previous, current)
+			}
 		}
-	}()
+	}
 }
 
 func main() {
 	flag.Parse()
 
-	if *listenOn == "" || *dataDir == "" {
+	if *listenOn == "" || (*dataDir == "" && *ntlmDataDir == "") {
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -82,15 +512,144 @@ func main() {
 	// For demo purposes
 	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
 
-	s := grpcbase.NewServer(*listenOn, "pwned-passwords", *jaegerEndpoint, func(srv *grpc.Server) {
-		s := &server{
-			storage: storage.NewLocalStorage(*dataDir),
+	if *cacheSize > 0 {
+		if err := view.Register(storage.CacheViews...); err != nil {
+			log.Fatalf("Could not register cache views: %s", err)
+		}
+	}
+
+	if *s3CacheDir != "" {
+		if err := view.Register(storage.TierViews...); err != nil {
+			log.Fatalf("Could not register tier views: %s", err)
 		}
-		pwnedpasswords.RegisterPwnedPasswordsServer(srv, s)
+	}
+
+	srv := &server{}
+	// All datasets are reopened on reload, only data directories have generations.
+	datasets := make(map[string]*storage.GenerationalStorage)
+	dataDirs := make(map[string]*storage.GenerationalStorage)
+	if *s3Bucket != "" {
+		if *dataDir != "" {
+			st, err := openS3(*dataDir, storage.HashTypeSHA1)
+			if err != nil {
+				log.Fatalf("Could not open dataset in S3: %s", err)
+			}
+			srv.storage = st
+			datasets[*dataDir] = st
+		}
+		if *ntlmDataDir != "" {
+			st, err := openS3(*ntlmDataDir, storage.HashTypeNTLM)
+			if err != nil {
+				log.Fatalf("Could not open NTLM dataset in S3: %s", err)
+			}
+			srv.ntlmStorage = st
+			datasets[*ntlmDataDir] = st
+		}
+	}
+	if *dataDir != "" && srv.storage == nil {
+		st, err := openDataDir(*dataDir, storage.HashTypeSHA1)
+		if err != nil {
+			log.Fatalf("Could not open data directory: %s", err)
+		}
+		srv.storage = st
+		datasets[*dataDir] = st
+		dataDirs[*dataDir] = st
+	}
+	if *ntlmDataDir != "" && srv.ntlmStorage == nil {
+		st, err := openDataDir(*ntlmDataDir, storage.HashTypeNTLM)
+		if err != nil {
+			log.Fatalf("Could not open NTLM data directory: %s", err)
+		}
+		srv.ntlmStorage = st
+		datasets[*ntlmDataDir] = st
+		dataDirs[*ntlmDataDir] = st
+	}
+
+	if *generationCheckInterval > 0 {
+		go watchGenerations(*generationCheckInterval, dataDirs)
+	}
+
+	s := grpcbase.NewServer(*listenOn, "pwned-passwords", *jaegerEndpoint, func(s *grpc.Server) {
+		pwnedpasswords.RegisterPwnedPasswordsServer(s, srv)
 	})
 	defer s.Stop()
 
-	if err := s.StartWithClient(registerHttpServer); err != nil {
+	if *tlsCertFile != "" || *tlsKeyFile != "" {
+		err := s.SetTLS(grpcbase.TLSConfig{
+			CertFile:     *tlsCertFile,
+			KeyFile:      *tlsKeyFile,
+			ClientCAFile: *tlsClientCAFile,
+		})
+		if err != nil {
+			log.Fatalf("Could not set up TLS: %s", err)
+		}
+	} else if *tlsClientCAFile != "" {
+		log.Fatal("Mutual TLS requires tlsCertFile and tlsKeyFile")
+	}
+
+	// Clients are authenticated first so they are rate limited by tenant.
+	if *apiKeyFile != "" {
+		if err := s.SetAPIKeys(*apiKeyFile); err != nil {
+			log.Fatalf("Could not set up API keys: %s", err)
+		}
+	}
+
+	if *rateLimit > 0 {
+		s.SetRateLimit(grpcbase.RateLimit{
+			Rate:  *rateLimit,
+			Burst: *rateLimitBurst,
+			// A single download request streams whole shards so every shard is charged.
+			MeteredMethods: []string{downloadRangeMethod},
+		})
+	}
+
+	if *internalListen != "" {
+		// Exact hash checks give up k-anonymity so they are never served on the public listener.
+		s.AddListener(*internalListen, func(s *grpc.Server) {
+			pwnedpasswords.RegisterPwnedPasswordsInternalServer(s, &internalServer{srv})
+		})
+	}
+
+	// Datasets are checked on every readiness check so a broken generation or an
+	// unmounted volume is noticed while serving.
+	if srv.storage != nil {
+		s.OnReadinessCheck("SHA-1 dataset", func(ctx context.Context) error {
+			return storage.Verify(ctx, srv.storage, *readinessSamples)
+		})
+	}
+	if srv.ntlmStorage != nil {
+		s.OnReadinessCheck("NTLM dataset", func(ctx context.Context) error {
+			return storage.Verify(ctx, srv.ntlmStorage, *readinessSamples)
+		})
+	}
+
+	// Every dataset is reloaded on its own so a failing one does not keep the others stale.
+	for dir, st := range datasets {
+		dir, st := dir, st
+		s.OnReload(func() error {
+			if err := st.Reopen(); err != nil {
+				return errors.WithMessagef(err, "reloading dataset '%s' failed", dir)
+			}
+			log.Printf("Reloaded dataset '%s' at generation '%s'", dir, st.Generation())
+			return nil
+		})
+	}
+
+	if *gatewayListen != "" {
+		s.SetGateway(grpcbase.GatewayConfig{
+			ListenOn:        *gatewayListen,
+			CertFile:        *gatewayCertFile,
+			KeyFile:         *gatewayKeyFile,
+			ReadTimeout:     *gatewayReadTimeout,
+			WriteTimeout:    *gatewayWriteTimeout,
+			IdleTimeout:     *gatewayIdleTimeout,
+			ShutdownTimeout: *gatewayShutdownTimeout,
+		}, func(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+			return gatewayHandler(ctx, conn, srv)
+		})
+	}
+
+	if err := s.Start(); err != nil {
 		log.Fatal(err)
 	}
 }
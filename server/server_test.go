@@ -3,6 +3,9 @@ package main
 import (
 	"context"
 	"io"
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 	"time"
 
@@ -12,13 +15,20 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func createService(storage storage.Storage) (pwnedpasswords.PwnedPasswordsClient, *grpctest.Server) {
-	s := &server{
+	return createServiceWithServer(&server{
 		storage: storage,
-	}
+	})
+}
+
+func createServiceWithServer(s *server) (pwnedpasswords.PwnedPasswordsClient, *grpctest.Server) {
 
 	testServer := grpctest.NewServer(func(srv *grpc.Server) {
 		pwnedpasswords.RegisterPwnedPasswordsServer(srv, s)
@@ -34,9 +44,9 @@ func TestServerListHashesForPrefixReturnsHashes(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockStorage := storage.NewMockStorage(ctrl)
-	mockStorage.EXPECT().Get(gomock.Any(), "aaaaa").Return([][]byte{
-		[]byte("abcdef"),
-		[]byte("123456"),
+	mockStorage.EXPECT().Get(gomock.Any(), "aaaaa").Return([]storage.Hash{
+		{Hash: []byte("abcdef"), Count: 3},
+		{Hash: []byte("123456"), Count: 1},
 	}, nil)
 
 	c, s := createService(mockStorage)
@@ -48,7 +58,7 @@ func TestServerListHashesForPrefixReturnsHashes(t *testing.T) {
 	resp, err := c.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{
 		HashPrefix: "aaaaa",
 	})
-	var hashes [][]byte
+	var hashes []storage.Hash
 	if assert.NoError(t, err) {
 		for {
 			r, err := resp.Recv()
@@ -56,21 +66,74 @@ func TestServerListHashesForPrefixReturnsHashes(t *testing.T) {
 				break
 			}
 			assert.NoError(t, err)
-			hashes = append(hashes, r.Hash)
+			hashes = append(hashes, storage.Hash{Hash: r.Hash, Count: r.Count})
 		}
 	}
 
-	assert.Equal(t, [][]byte{
-		[]byte("abcdef"),
-		[]byte("123456"),
+	assert.Equal(t, []storage.Hash{
+		{Hash: []byte("abcdef"), Count: 3},
+		{Hash: []byte("123456"), Count: 1},
 	}, hashes)
 }
 
+func TestServerListHashesForPrefixReturnsNTLMHashes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "bbbbb").Return([]storage.Hash{
+		{Hash: []byte("ntlm"), Count: 2},
+	}, nil)
+
+	c, s := createServiceWithServer(&server{
+		storage:     storage.NewMockStorage(ctrl),
+		ntlmStorage: mockStorage,
+	})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := c.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{
+		HashPrefix: "bbbbb",
+		HashType:   pwnedpasswords.HashType_NTLM,
+	})
+	if assert.NoError(t, err) {
+		r, err := resp.Recv()
+		if assert.NoError(t, err) {
+			assert.Equal(t, []byte("ntlm"), r.Hash)
+			assert.Equal(t, uint32(2), r.Count)
+		}
+	}
+}
+
+func TestServerListHashesForPrefixFailsIfDatasetIsNotAvailable(t *testing.T) {
+	c, s := createService(&errorStorage{errors.New("unused")})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := c.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{
+		HashPrefix: "aaaaa",
+		HashType:   pwnedpasswords.HashType_NTLM,
+	})
+
+	if assert.NoError(t, err) {
+		_, err := resp.Recv()
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	}
+}
+
 type errorStorage struct {
 	err error
 }
 
-func (s *errorStorage) Get(ctx context.Context, key string) (result [][]byte, err error) {
+func (s *errorStorage) Get(ctx context.Context, key string) (result []storage.Hash, err error) {
+	return nil, s.err
+}
+
+func (s *errorStorage) GetShard(ctx context.Context, key string) (shard []byte, err error) {
 	return nil, s.err
 }
 
@@ -92,8 +155,52 @@ func TestServerListHashesForPrefixFailsWithGenericError(t *testing.T) {
 	}
 }
 
+func TestServerListHashesForPrefixFailsWithDataLossOnCorruptedShard(t *testing.T) {
+	c, s := createService(&errorStorage{errors.WithMessage(&storage.CorruptionError{Reason: "truncated"}, "decoding failed")})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := c.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{
+		HashPrefix: "aaaaa",
+	})
+
+	if assert.NoError(t, err) {
+		_, err := resp.Recv()
+		assert.Equal(t, codes.DataLoss, status.Code(err))
+	}
+}
+
+func TestServerListHashesForPrefixMapsStorageErrorsToCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{errors.WithMessage(storage.ErrNotFound, "missing"), codes.NotFound},
+		{&storage.TransientError{Err: errors.New("timeout")}, codes.Unavailable},
+		{errors.WithMessage(os.ErrPermission, "open failed"), codes.Internal},
+	}
+
+	for _, test := range tests {
+		c, s := createService(&errorStorage{test.err})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		resp, err := c.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{
+			HashPrefix: "aaaaa",
+		})
+		if assert.NoError(t, err) {
+			_, err := resp.Recv()
+			assert.Equal(t, test.code, status.Code(err), "%v", test.err)
+		}
+
+		cancel()
+		s.Close()
+	}
+}
+
 func TestServerListHashesForPrefixFailsIfHashPrefixIsOfInvalidLength(t *testing.T) {
-	c, s := createService(nil)
+	c, s := createService(&errorStorage{})
 	defer s.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -109,3 +216,346 @@ func TestServerListHashesForPrefixFailsIfHashPrefixIsOfInvalidLength(t *testing.
 		assert.Contains(t, err.Error(), "prefix length must be")
 	}
 }
+
+func TestServerListHashesForPrefixAcceptsUppercasePrefix(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "abcde").Return([]storage.Hash{{Hash: []byte("abcdef"), Count: 3}}, nil)
+
+	c, s := createService(mockStorage)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := c.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{
+		HashPrefix: "ABcDE",
+	})
+	if assert.NoError(t, err) {
+		h, err := resp.Recv()
+		if assert.NoError(t, err) {
+			assert.Equal(t, []byte("abcdef"), h.Hash)
+		}
+	}
+}
+
+func TestServerRejectsPrefixesThatAreNotHexadecimal(t *testing.T) {
+	c, s := createService(&errorStorage{errors.New("unused")})
+	defer s.Close()
+
+	for _, prefix := range []string{"", "zzzzz", "../..", "ab/cd", "abcd\x00", " abcd"} {
+		t.Run(prefix, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			resp, err := c.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{HashPrefix: prefix})
+			if assert.NoError(t, err) {
+				_, err := resp.Recv()
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+				assert.Contains(t, err.Error(), "prefix must be hexadecimal")
+			}
+
+			stream, err := c.CheckPrefixes(ctx)
+			if assert.NoError(t, err) {
+				assert.NoError(t, stream.Send(&pwnedpasswords.CheckPrefixesRequest{HashPrefix: prefix}))
+				_, err := stream.Recv()
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			}
+		})
+	}
+}
+
+func TestServerUsesPrefixLengthFromManifest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "aaaa").Return([]storage.Hash{{Hash: []byte("abcdef"), Count: 3}}, nil)
+	mockStorage.EXPECT().GetShard(gomock.Any(), "fffe").Return(nil, storage.ErrNotFound)
+	mockStorage.EXPECT().GetShard(gomock.Any(), "ffff").Return(nil, storage.ErrNotFound)
+
+	c, s := createService(storage.WithManifest(mockStorage, storage.Manifest{PrefixLength: 4}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var trailer metadata.MD
+	resp, err := c.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{HashPrefix: "aaaaa"}, grpc.Trailer(&trailer))
+	if assert.NoError(t, err) {
+		_, err := resp.Recv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, []string{"4"}, trailer.Get(prefixLengthKey))
+	}
+
+	resp, err = c.ListHashesForPrefix(ctx, &pwnedpasswords.ListRequest{HashPrefix: "aaaa"})
+	if assert.NoError(t, err) {
+		h, err := resp.Recv()
+		if assert.NoError(t, err) {
+			assert.Equal(t, []byte("abcdef"), h.Hash)
+		}
+	}
+
+	download, err := c.DownloadRange(ctx, &pwnedpasswords.DownloadRangeRequest{StartPrefix: "fffe", EndPrefix: "ffff"})
+	if assert.NoError(t, err) {
+		_, err := download.Recv()
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestServerCheckPrefixesReturnsHashesTaggedWithRequestId(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockStorage.EXPECT().Get(gomock.Any(), "aaaaa").Return([]storage.Hash{
+		{Hash: []byte("abcdef"), Count: 3},
+	}, nil)
+	mockStorage.EXPECT().Get(gomock.Any(), "bbbbb").Return([]storage.Hash{
+		{Hash: []byte("123456"), Count: 1},
+		{Hash: []byte("654321"), Count: 2},
+	}, nil)
+
+	c, s := createService(mockStorage)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := c.CheckPrefixes(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, stream.Send(&pwnedpasswords.CheckPrefixesRequest{RequestId: 7, HashPrefix: "aaaaa"}))
+	assert.NoError(t, stream.Send(&pwnedpasswords.CheckPrefixesRequest{RequestId: 9, HashPrefix: "bbbbb"}))
+	assert.NoError(t, stream.CloseSend())
+
+	hashCounts := make(map[uint64]int)
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		hashCounts[r.RequestId] = len(r.Hashes)
+	}
+
+	assert.Equal(t, map[uint64]int{7: 1, 9: 2}, hashCounts)
+}
+
+func TestServerCheckPrefixesFailsIfHashPrefixIsOfInvalidLength(t *testing.T) {
+	c, s := createService(&errorStorage{})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := c.CheckPrefixes(ctx)
+	if assert.NoError(t, err) {
+		assert.NoError(t, stream.Send(&pwnedpasswords.CheckPrefixesRequest{RequestId: 1, HashPrefix: "aa"}))
+		_, err := stream.Recv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestServerDownloadRangeReturnsShardsInPrefixOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	shard, err := storage.EncodeShard(storage.HashTypeSHA1, []storage.Hash{
+		{Hash: make([]byte, 20), Count: 1},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	header, err := storage.DecodeShardHeader(shard)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	gomock.InOrder(
+		mockStorage.EXPECT().GetShard(gomock.Any(), "0000e").Return(shard, nil),
+		mockStorage.EXPECT().GetShard(gomock.Any(), "0000f").Return(nil, storage.ErrNotFound),
+		mockStorage.EXPECT().GetShard(gomock.Any(), "00010").Return(shard, nil),
+	)
+
+	c, s := createService(mockStorage)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := c.DownloadRange(ctx, &pwnedpasswords.DownloadRangeRequest{
+		StartPrefix: "0000e",
+		EndPrefix:   "00010",
+	})
+	var prefixes []string
+	if assert.NoError(t, err) {
+		for {
+			r, err := resp.Recv()
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, shard, r.Data)
+			assert.Equal(t, header.Checksum, r.Checksum)
+			prefixes = append(prefixes, r.HashPrefix)
+		}
+	}
+
+	assert.Equal(t, []string{"0000e", "00010"}, prefixes)
+}
+
+func TestServerDownloadRangeFailsOnInvalidRange(t *testing.T) {
+	c, s := createService(&errorStorage{})
+	defer s.Close()
+
+	tests := []struct {
+		name  string
+		start string
+		end   string
+	}{
+		{"invalid start length", "aa", "bbbbb"},
+		{"invalid end length", "aaaaa", "bb"},
+		{"not hexadecimal", "zzzzz", "bbbbb"},
+		{"start after end", "bbbbb", "aaaaa"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			resp, err := c.DownloadRange(ctx, &pwnedpasswords.DownloadRangeRequest{
+				StartPrefix: tc.start,
+				EndPrefix:   tc.end,
+			})
+			if assert.NoError(t, err) {
+				_, err := resp.Recv()
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			}
+		})
+	}
+}
+
+func TestServerGetDatasetInfoReturnsManifest(t *testing.T) {
+	buildTime := time.Date(2019, 7, 20, 10, 30, 0, 0, time.UTC)
+	c, s := createServiceWithServer(&server{
+		storage: storage.NewLocalStorage("", storage.HashTypeSHA1),
+		ntlmStorage: storage.WithManifest(storage.NewLocalStorage("", storage.HashTypeNTLM), storage.Manifest{
+			HashType:     storage.HashTypeNTLM,
+			PrefixLength: 4,
+			Encoding:     storage.ShardEncodingCompact,
+			Version:      "v5",
+			ReleaseDate:  "2019-07-18",
+			HashCount:    555278657,
+			BuildTime:    buildTime,
+			Checksum:     "abcdef",
+		}),
+	})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := c.GetDatasetInfo(ctx, &pwnedpasswords.DatasetInfoRequest{HashType: pwnedpasswords.HashType_NTLM})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "v5", info.Version)
+		assert.Equal(t, "2019-07-18", info.ReleaseDate)
+		assert.Equal(t, pwnedpasswords.HashType_NTLM, info.HashType)
+		assert.Equal(t, uint32(4), info.PrefixLength)
+		assert.Equal(t, uint64(555278657), info.HashCount)
+		assert.Equal(t, buildTime.Unix(), info.BuildTime.GetSeconds())
+		assert.Equal(t, "abcdef", info.Checksum)
+		assert.Equal(t, "compact", info.Encoding)
+	}
+
+	// Datasets without a manifest are described by the default manifest.
+	info, err = c.GetDatasetInfo(ctx, &pwnedpasswords.DatasetInfoRequest{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(storage.DefaultPrefixLength), info.PrefixLength)
+		assert.Nil(t, info.BuildTime)
+		assert.Empty(t, info.Encoding)
+	}
+}
+
+func TestServerGetDatasetInfoFailsIfDatasetIsNotAvailable(t *testing.T) {
+	c, s := createService(&errorStorage{})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := c.GetDatasetInfo(ctx, &pwnedpasswords.DatasetInfoRequest{HashType: pwnedpasswords.HashType_NTLM})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestOpenDataDirKeepsGenerationThatFailsVerification(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := storage.DefaultManifest()
+	m.HashType = storage.HashTypeSHA1
+	m.Encoding = storage.ShardEncodingRaw
+	for _, name := range []string{"v1", "v2"} {
+		require.NoError(t, os.Mkdir(path.Join(dir, name), 0755))
+		require.NoError(t, storage.WriteManifest(path.Join(dir, name), m))
+	}
+	shard, err := storage.EncodeShard(storage.HashTypeSHA1, []storage.Hash{{Hash: make([]byte, 20), Count: 1}})
+	require.NoError(t, err)
+	require.NoError(t, storage.WriteShardFile(path.Join(dir, "v1"), "00000", shard))
+	require.NoError(t, storage.SetCurrentGeneration(dir, "v1"))
+
+	st, err := openDataDir(dir, storage.HashTypeSHA1)
+	require.NoError(t, err)
+
+	// The second generation has no shards, as if it was not copied completely.
+	require.NoError(t, storage.SetCurrentGeneration(dir, "v2"))
+	assert.Error(t, st.Reload())
+	assert.Error(t, st.Reopen())
+	assert.Equal(t, "v1", st.Generation())
+}
+
+func TestS3CacheDirIsSeparatedByRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(old string) { *s3CacheDir = old }(*s3CacheDir)
+	*s3CacheDir = dir
+
+	m := storage.DefaultManifest()
+	m.Checksum = "abcdef"
+	first, err := s3CacheDirFor("sha1", m)
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "sha1", "abcdef"), first)
+	require.NoError(t, storage.WriteShardFile(first, "00000", []byte("shard")))
+
+	same, err := s3CacheDirFor("sha1", m)
+	require.NoError(t, err)
+	assert.Equal(t, first, same)
+	_, err = os.Stat(first)
+	assert.NoError(t, err, "the cache of the same release is kept")
+
+	m.Checksum = ""
+	m.BuildTime = time.Date(2019, 7, 19, 12, 0, 0, 0, time.UTC)
+	second, err := s3CacheDirFor("sha1", m)
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "sha1", "20190719T120000Z"), second)
+	_, err = os.Stat(first)
+	assert.True(t, os.IsNotExist(err), "the cache of the previous release is removed")
+
+	m.Checksum = "../../escape"
+	m.BuildTime = time.Time{}
+	third, err := s3CacheDirFor("sha1", m)
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "sha1", "default"), third)
+}